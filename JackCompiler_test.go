@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"compiler/ast"
+	"compiler/lexer"
+	"compiler/parser"
+	"compiler/token"
+)
+
+// writeJack puts src into a .jack file inside a temporary directory
+func writeJack(t *testing.T, name string, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+func TestCompileMixedWhitespace(t *testing.T) {
+	src := `class Main {
+    function void main() {
+        var int i;
+        let i = 0;
+        while (i < 10) {
+            do Output.printInt(i);
+            let i = i + 1;
+        }
+        return;
+    }
+}
+`
+	mixed := "\ufeff" + strings.NewReplacer("\n", "\r\n", "    ", "\t", " = ", "\t=\f").Replace(src)
+
+	compile := func(src string) string {
+		labelCount = 0
+		path := writeJack(t, "Main.jack", src)
+		out, err := os.Create(createVmOutput(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		class := parser.New(buildTokenizer(path)).CompileClass()
+		buildResolver([]*ast.Class{class}, nil).resolveClass(class)
+		buildCompilationEngine2(out).compileClass(class)
+		_ = out.Close()
+		vm, err := os.ReadFile(createVmOutput(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(vm)
+	}
+
+	if got, want := compile(mixed), compile(src); got != want {
+		t.Errorf("mixed whitespace compiled to\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCompileCalls(t *testing.T) {
+	src := `class Counter {
+    field int count;
+    field Counter next;
+    static int total;
+    constructor Counter new() { let next = null; return this; }
+    function int zero() { return 0; }
+    method void add(int n, int count) {
+        let count = count + n;
+        do bump();
+        do next.add(n, count);
+        let total = Counter.zero() + zero();
+        do Output.printInt(count);
+        return;
+    }
+    method void bump() { return; }
+}`
+	want := `function Counter.new 0
+push constant 2
+call Memory.alloc 1
+pop pointer 0
+push constant 0
+pop this 1
+push pointer 0
+return
+function Counter.zero 0
+push constant 0
+return
+function Counter.add 0
+push argument 0
+pop pointer 0
+push argument 2
+push argument 1
+add
+pop argument 2
+push pointer 0
+call Counter.bump 1
+pop temp 0
+push this 1
+push argument 1
+push argument 2
+call Counter.add 3
+pop temp 0
+call Counter.zero 0
+call Counter.zero 0
+add
+pop static 0
+push argument 2
+call Output.printInt 1
+pop temp 0
+push constant 0
+return
+function Counter.bump 0
+push argument 0
+pop pointer 0
+push constant 0
+return
+`
+	var out strings.Builder
+	if errs := compile(lexer.New(strings.NewReader(src), "Counter.jack"), &out); token.HasErrors(errs) {
+		t.Fatal(errs)
+	}
+	if out.String() != want {
+		t.Errorf("compiled to\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+// the else branch runs when the condition is false, after IF_FALSE
+func TestCompileIfElse(t *testing.T) {
+	src := "class Main { function int f(boolean b) { if (b) { return 1; } else { return 2; } } }"
+	want := `function Main.f 0
+push argument 0
+not
+if-goto IF_FALSE0
+push constant 1
+return
+goto OUT0
+label IF_FALSE0
+push constant 2
+return
+label OUT0
+`
+	labelCount = 0
+	var out strings.Builder
+	if errs := compile(lexer.New(strings.NewReader(src), "Main.jack"), &out); token.HasErrors(errs) {
+		t.Fatal(errs)
+	}
+	if out.String() != want {
+		t.Errorf("compiled to\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+// the classes of every complete program in testdata compile together to
+// exactly testdata/*/X.vm
+func TestVMGolden(t *testing.T) {
+	for _, dir := range []string{"ArrayTest", "Square"} {
+		sources, err := filepath.Glob(filepath.Join("testdata", dir, "*.jack"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokenizers := make([]*lexer.Tokenizer, len(sources))
+		outs := make([]io.Writer, len(sources))
+		for i, source := range sources {
+			tokenizers[i] = buildTokenizer(source)
+			outs[i] = &bytes.Buffer{}
+		}
+		labelCount = 0
+		for i, errs := range compileProgram(tokenizers, outs, programClassNames(filepath.Join("testdata", dir), sources)) {
+			golden := strings.TrimSuffix(sources[i], ".jack") + ".vm"
+			got := outs[i].(*bytes.Buffer).Bytes()
+			switch {
+			case len(errs) > 0:
+				t.Errorf("%s: %v", sources[i], errs)
+			case *update:
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			default:
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s differs from %s:\n%s", sources[i], golden, got)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Package ast is the abstract syntax tree of a Jack class, built once by the
+// parser and read by every backend, with Walk and Rewrite to visit and
+// transform it. The resolver adds the symbol tables of the class and of its
+// subroutines
+package ast
+
+import "compiler/token"
+
+// Node is any node of the syntax tree
+type Node interface {
+	Pos() token.Position
+	End() token.Position
+}
+
+// Statement is a let, if, while, do or return statement
+type Statement interface {
+	Node
+	statementNode()
+}
+
+// Expression is an expression or one of its terms
+type Expression interface {
+	Node
+	expressionNode()
+}
+
+// Span holds what every node has, where its tokens start and end
+type Span struct {
+	From token.Position // the first byte of the first token
+	To   token.Position // right after the last token
+}
+
+// Pos is the position of the first token of the node
+func (n *Span) Pos() token.Position {
+	return n.From
+}
+
+// End is the position right after the last token of the node
+func (n *Span) End() token.Position {
+	return n.To
+}
+
+// contains tells whether the line and column of p are within n, from its
+// first byte up to but not including the byte after it
+func contains(n Node, p token.Position) bool {
+	start, end := n.Pos(), n.End()
+	return (start.Line < p.Line || start.Line == p.Line && start.Column <= p.Column) &&
+		(p.Line < end.Line || p.Line == end.Line && p.Column < end.Column)
+}
+
+// NodeAt returns the innermost node below root, root included, whose span
+// holds the line and column of pos, or nil when there is none
+func NodeAt(root Node, pos token.Position) Node {
+	var found Node
+	Inspect(root, func(n Node) bool {
+		if !contains(n, pos) {
+			return false
+		}
+		found = n
+		return true
+	})
+	return found
+}
+
+// Identifier is a class, subroutine or variable name
+type Identifier struct {
+	Span
+	Name string
+}
+
+// Type is int, char, boolean, void or a class name
+type Type struct {
+	Span
+	Name string
+}
+
+// IsBuiltin tells the types spelled with a keyword from class names
+func (t *Type) IsBuiltin() bool {
+	switch token.Lookup(t.Name) {
+	case token.KeywordInt, token.KeywordChar, token.KeywordBoolean, token.KeywordVoid:
+		return true
+	}
+	return false
+}
+
+type Class struct {
+	Span
+	Name        *Identifier
+	VarDecs     []*ClassVarDec
+	Subroutines []*SubroutineDec
+	Symbols     *SymbolTable // the statics and fields, nil until the class is resolved
+}
+
+// ClassVarDec declares one or more static or field variables
+type ClassVarDec struct {
+	Span
+	Kind  token.Keyword // token.KeywordStatic or token.KeywordField
+	Type  *Type
+	Names []*Identifier
+}
+
+type SubroutineDec struct {
+	Span
+	Kind       token.Keyword // token.KeywordConstructor, token.KeywordFunction or token.KeywordMethod
+	ReturnType *Type
+	Name       *Identifier
+	Params     []*Parameter
+	Body       *SubroutineBody
+	Symbols    *SymbolTable // the arguments and locals, nil until the class is resolved
+}
+
+type Parameter struct {
+	Span
+	Type *Type
+	Name *Identifier
+}
+
+type SubroutineBody struct {
+	Span
+	VarDecs    []*VarDec
+	Statements []Statement
+}
+
+// VarDec declares one or more local variables
+type VarDec struct {
+	Span
+	Type  *Type
+	Names []*Identifier
+}
+
+/*
+Statements
+*/
+
+type LetStatement struct {
+	Span
+	Name  *Identifier
+	Index Expression // nil unless the target is an array element
+	Value Expression
+}
+
+type IfStatement struct {
+	Span
+	Condition Expression
+	Then      []Statement
+	HasElse   bool
+	Else      []Statement
+}
+
+type WhileStatement struct {
+	Span
+	Condition Expression
+	Body      []Statement
+}
+
+type DoStatement struct {
+	Span
+	Call *SubroutineCall
+}
+
+type ReturnStatement struct {
+	Span
+	Value Expression // nil for a bare return
+}
+
+func (*LetStatement) statementNode()    {}
+func (*IfStatement) statementNode()     {}
+func (*WhileStatement) statementNode()  {}
+func (*DoStatement) statementNode()     {}
+func (*ReturnStatement) statementNode() {}
+
+/*
+Expressions
+*/
+
+// BinaryExpression applies Op to Left and Right. Jack has no precedence, so
+// a chain of operators is nested to the left: a+b*c is (a+b)*c
+type BinaryExpression struct {
+	Span
+	Op    token.SymbolChar
+	Left  Expression
+	Right Expression
+}
+
+// Chain unwinds a chain of operators into its first operand and the
+// expressions that apply each operator in turn, a+b*c into a, a+b and
+// (a+b)*c. The chain is followed in a loop, so that however long it is it
+// does not grow the stack of the caller the way recursing on Left would
+func Chain(e *BinaryExpression) (Expression, []*BinaryExpression) {
+	ops := []*BinaryExpression{e}
+	for b, ok := e.Left.(*BinaryExpression); ok && b != nil; b, ok = b.Left.(*BinaryExpression) {
+		ops = append(ops, b)
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops[0].Left, ops
+}
+
+type UnaryExpression struct {
+	Span
+	Op      token.SymbolChar // token.SymbolMinus or token.SymbolTilde
+	Operand Expression
+}
+
+// ParenExpression is an expression in parentheses used as a term
+type ParenExpression struct {
+	Span
+	Inner Expression
+}
+
+type IntegerConstant struct {
+	Span
+	Value int
+}
+
+// StringConstant holds the string without its quotes
+type StringConstant struct {
+	Span
+	Value string
+}
+
+// KeywordConstant is true, false, null or this
+type KeywordConstant struct {
+	Span
+	Value token.Keyword
+}
+
+type VarRef struct {
+	Span
+	Name *Identifier
+}
+
+// ArrayAccess is name[index]
+type ArrayAccess struct {
+	Span
+	Name  *Identifier
+	Index Expression
+}
+
+// SubroutineCall is name(args) or receiver.name(args), where the receiver is
+// a variable or a class name
+type SubroutineCall struct {
+	Span
+	Receiver *Identifier // nil for name(args)
+	Name     *Identifier
+	Args     []Expression
+}
+
+func (*BinaryExpression) expressionNode() {}
+func (*UnaryExpression) expressionNode()  {}
+func (*ParenExpression) expressionNode()  {}
+func (*IntegerConstant) expressionNode()  {}
+func (*StringConstant) expressionNode()   {}
+func (*KeywordConstant) expressionNode()  {}
+func (*VarRef) expressionNode()           {}
+func (*ArrayAccess) expressionNode()      {}
+func (*SubroutineCall) expressionNode()   {}
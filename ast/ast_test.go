@@ -0,0 +1,62 @@
+package ast_test
+
+import (
+	"reflect"
+	"testing"
+
+	"compiler/ast"
+	"compiler/token"
+)
+
+func at(line, column int) token.Position {
+	return token.Position{File: "Main.jack", Line: line, Column: column}
+}
+
+// x + 1 built by hand, the way a tool outside the compiler would
+func sum() *ast.BinaryExpression {
+	x := &ast.VarRef{Span: ast.Span{From: at(1, 1), To: at(1, 2)}, Name: &ast.Identifier{Span: ast.Span{From: at(1, 1), To: at(1, 2)}, Name: "x"}}
+	one := &ast.IntegerConstant{Span: ast.Span{From: at(1, 5), To: at(1, 6)}, Value: 1}
+	return &ast.BinaryExpression{Span: ast.Span{From: at(1, 1), To: at(1, 6)}, Op: token.SymbolPlus, Left: x, Right: one}
+}
+
+func TestInspectAndNodeAt(t *testing.T) {
+	var names []string
+	ast.Inspect(sum(), func(n ast.Node) bool {
+		if id, ok := n.(*ast.Identifier); ok {
+			names = append(names, id.Name)
+		}
+		return true
+	})
+	if !reflect.DeepEqual(names, []string{"x"}) {
+		t.Errorf("got identifiers %q", names)
+	}
+	if n, ok := ast.NodeAt(sum(), at(1, 5)).(*ast.IntegerConstant); !ok || n.Value != 1 {
+		t.Errorf("got %#v at 1:5", n)
+	}
+	if n := ast.NodeAt(sum(), at(1, 6)); n != nil {
+		t.Errorf("got %T right after the expression", n)
+	}
+}
+
+func TestRewriteFunc(t *testing.T) {
+	e := ast.Rewrite(ast.RewriteFunc(func(n ast.Node) ast.Node {
+		if c, ok := n.(*ast.IntegerConstant); ok {
+			return &ast.IntegerConstant{Span: c.Span, Value: c.Value + 1}
+		}
+		return n
+	}), sum()).(*ast.BinaryExpression)
+	if c := e.Right.(*ast.IntegerConstant); c.Value != 2 {
+		t.Errorf("got %d", c.Value)
+	}
+}
+
+// a redeclared variable takes no second slot
+func TestDefineKeepsTheFirstDeclaration(t *testing.T) {
+	table := ast.NewSymbolTable(ast.SubroutineLevel)
+	if !table.Define("x", "int", ast.KindVar) || table.Define("x", "char", ast.KindVar) || !table.Define("y", "int", ast.KindVar) {
+		t.Fatal("Define accepted a redeclaration or refused a new name")
+	}
+	if table.VarCount(ast.KindVar) != 2 || table.TypeOf("x") != "int" || table.IndexOf("y") != 1 {
+		t.Errorf("got %d locals, x is %s, y is local %d", table.VarCount(ast.KindVar), table.TypeOf("x"), table.IndexOf("y"))
+	}
+}
@@ -0,0 +1,76 @@
+package ast
+
+// Level tells a table of statics and fields from one of arguments and locals
+type Level int
+
+const (
+	ClassLevel Level = iota
+	SubroutineLevel
+)
+
+// SymbolKind is the segment a variable lives in
+type SymbolKind string
+
+const (
+	KindStatic SymbolKind = "static"
+	KindField  SymbolKind = "field"
+	KindArg    SymbolKind = "arg"
+	KindVar    SymbolKind = "var"
+)
+
+// SymbolTable is the variables declared by a class or a subroutine. The
+// resolver builds one for each and sets it as Symbols of the node, the type
+// checker and the code generator read it from there
+type SymbolTable struct {
+	Level     Level
+	Symbols   map[string]Symbol
+	kindCount map[SymbolKind]int
+}
+
+// Symbol is a variable, Index is its place among the variables of its kind
+type Symbol struct {
+	Name  string
+	Type  string
+	Kind  SymbolKind
+	Index int
+}
+
+func NewSymbolTable(level Level) *SymbolTable {
+	return &SymbolTable{
+		Level:     level,
+		Symbols:   make(map[string]Symbol),
+		kindCount: make(map[SymbolKind]int),
+	}
+}
+
+// Define adds name to the table, a name already in it is left as it is and
+// Define returns false
+func (s *SymbolTable) Define(name string, typeName string, kind SymbolKind) bool {
+	if _, ok := s.Symbols[name]; ok {
+		return false
+	}
+	s.Symbols[name] = Symbol{Name: name, Type: typeName, Kind: kind, Index: s.kindCount[kind]}
+	s.kindCount[kind]++
+	return true
+}
+
+// VarCount is the number of variables of kind
+func (s *SymbolTable) VarCount(kind SymbolKind) int {
+	return s.kindCount[kind]
+}
+
+func (s *SymbolTable) KindOf(name string) SymbolKind {
+	return s.Symbols[name].Kind
+}
+
+func (s *SymbolTable) TypeOf(name string) string {
+	return s.Symbols[name].Type
+}
+
+// IndexOf is the index of name in its segment, -1 when it is not in the table
+func (s *SymbolTable) IndexOf(name string) int {
+	if _, ok := s.Symbols[name]; !ok {
+		return -1
+	}
+	return s.Symbols[name].Index
+}
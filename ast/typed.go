@@ -0,0 +1,235 @@
+package ast
+
+import "fmt"
+
+// TypedVisitor has a hook per node type, called by WalkTyped: VisitXxx
+// before the children of a node and LeaveXxx after them. When VisitXxx
+// returns false the children and LeaveXxx are skipped. Embedding BaseVisitor
+// gives the hooks that are not needed, so a visitor only writes the ones it
+// wants
+type TypedVisitor interface {
+	VisitClass(n *Class) bool
+	LeaveClass(n *Class)
+	VisitClassVarDec(n *ClassVarDec) bool
+	LeaveClassVarDec(n *ClassVarDec)
+	VisitSubroutineDec(n *SubroutineDec) bool
+	LeaveSubroutineDec(n *SubroutineDec)
+	VisitParameter(n *Parameter) bool
+	LeaveParameter(n *Parameter)
+	VisitSubroutineBody(n *SubroutineBody) bool
+	LeaveSubroutineBody(n *SubroutineBody)
+	VisitVarDec(n *VarDec) bool
+	LeaveVarDec(n *VarDec)
+	VisitLetStatement(n *LetStatement) bool
+	LeaveLetStatement(n *LetStatement)
+	VisitIfStatement(n *IfStatement) bool
+	LeaveIfStatement(n *IfStatement)
+	VisitWhileStatement(n *WhileStatement) bool
+	LeaveWhileStatement(n *WhileStatement)
+	VisitDoStatement(n *DoStatement) bool
+	LeaveDoStatement(n *DoStatement)
+	VisitReturnStatement(n *ReturnStatement) bool
+	LeaveReturnStatement(n *ReturnStatement)
+	VisitBinaryExpression(n *BinaryExpression) bool
+	LeaveBinaryExpression(n *BinaryExpression)
+	VisitUnaryExpression(n *UnaryExpression) bool
+	LeaveUnaryExpression(n *UnaryExpression)
+	VisitParenExpression(n *ParenExpression) bool
+	LeaveParenExpression(n *ParenExpression)
+	VisitVarRef(n *VarRef) bool
+	LeaveVarRef(n *VarRef)
+	VisitArrayAccess(n *ArrayAccess) bool
+	LeaveArrayAccess(n *ArrayAccess)
+	VisitSubroutineCall(n *SubroutineCall) bool
+	LeaveSubroutineCall(n *SubroutineCall)
+	VisitIdentifier(n *Identifier) bool
+	LeaveIdentifier(n *Identifier)
+	VisitType(n *Type) bool
+	LeaveType(n *Type)
+	VisitIntegerConstant(n *IntegerConstant) bool
+	LeaveIntegerConstant(n *IntegerConstant)
+	VisitStringConstant(n *StringConstant) bool
+	LeaveStringConstant(n *StringConstant)
+	VisitKeywordConstant(n *KeywordConstant) bool
+	LeaveKeywordConstant(n *KeywordConstant)
+}
+
+// BaseVisitor is a TypedVisitor that visits every node and does nothing
+type BaseVisitor struct{}
+
+func (BaseVisitor) VisitClass(*Class) bool { return true }
+func (BaseVisitor) LeaveClass(*Class)      {}
+
+func (BaseVisitor) VisitClassVarDec(*ClassVarDec) bool { return true }
+func (BaseVisitor) LeaveClassVarDec(*ClassVarDec)      {}
+
+func (BaseVisitor) VisitSubroutineDec(*SubroutineDec) bool { return true }
+func (BaseVisitor) LeaveSubroutineDec(*SubroutineDec)      {}
+
+func (BaseVisitor) VisitParameter(*Parameter) bool { return true }
+func (BaseVisitor) LeaveParameter(*Parameter)      {}
+
+func (BaseVisitor) VisitSubroutineBody(*SubroutineBody) bool { return true }
+func (BaseVisitor) LeaveSubroutineBody(*SubroutineBody)      {}
+
+func (BaseVisitor) VisitVarDec(*VarDec) bool { return true }
+func (BaseVisitor) LeaveVarDec(*VarDec)      {}
+
+func (BaseVisitor) VisitLetStatement(*LetStatement) bool { return true }
+func (BaseVisitor) LeaveLetStatement(*LetStatement)      {}
+
+func (BaseVisitor) VisitIfStatement(*IfStatement) bool { return true }
+func (BaseVisitor) LeaveIfStatement(*IfStatement)      {}
+
+func (BaseVisitor) VisitWhileStatement(*WhileStatement) bool { return true }
+func (BaseVisitor) LeaveWhileStatement(*WhileStatement)      {}
+
+func (BaseVisitor) VisitDoStatement(*DoStatement) bool { return true }
+func (BaseVisitor) LeaveDoStatement(*DoStatement)      {}
+
+func (BaseVisitor) VisitReturnStatement(*ReturnStatement) bool { return true }
+func (BaseVisitor) LeaveReturnStatement(*ReturnStatement)      {}
+
+func (BaseVisitor) VisitBinaryExpression(*BinaryExpression) bool { return true }
+func (BaseVisitor) LeaveBinaryExpression(*BinaryExpression)      {}
+
+func (BaseVisitor) VisitUnaryExpression(*UnaryExpression) bool { return true }
+func (BaseVisitor) LeaveUnaryExpression(*UnaryExpression)      {}
+
+func (BaseVisitor) VisitParenExpression(*ParenExpression) bool { return true }
+func (BaseVisitor) LeaveParenExpression(*ParenExpression)      {}
+
+func (BaseVisitor) VisitVarRef(*VarRef) bool { return true }
+func (BaseVisitor) LeaveVarRef(*VarRef)      {}
+
+func (BaseVisitor) VisitArrayAccess(*ArrayAccess) bool { return true }
+func (BaseVisitor) LeaveArrayAccess(*ArrayAccess)      {}
+
+func (BaseVisitor) VisitSubroutineCall(*SubroutineCall) bool { return true }
+func (BaseVisitor) LeaveSubroutineCall(*SubroutineCall)      {}
+
+func (BaseVisitor) VisitIdentifier(*Identifier) bool { return true }
+func (BaseVisitor) LeaveIdentifier(*Identifier)      {}
+
+func (BaseVisitor) VisitType(*Type) bool { return true }
+func (BaseVisitor) LeaveType(*Type)      {}
+
+func (BaseVisitor) VisitIntegerConstant(*IntegerConstant) bool { return true }
+func (BaseVisitor) LeaveIntegerConstant(*IntegerConstant)      {}
+
+func (BaseVisitor) VisitStringConstant(*StringConstant) bool { return true }
+func (BaseVisitor) LeaveStringConstant(*StringConstant)      {}
+
+func (BaseVisitor) VisitKeywordConstant(*KeywordConstant) bool { return true }
+func (BaseVisitor) LeaveKeywordConstant(*KeywordConstant)      {}
+
+// WalkTyped is Walk with the hooks of v for the type of each node
+func WalkTyped(v TypedVisitor, n Node) {
+	Walk(typedVisitor{v}, n)
+}
+
+// typedVisitor is the Visitor that calls the hook of a TypedVisitor for each node
+type typedVisitor struct {
+	v TypedVisitor
+}
+
+func (t typedVisitor) Pre(n Node) bool {
+	switch n := n.(type) {
+	case *Class:
+		return t.v.VisitClass(n)
+	case *ClassVarDec:
+		return t.v.VisitClassVarDec(n)
+	case *SubroutineDec:
+		return t.v.VisitSubroutineDec(n)
+	case *Parameter:
+		return t.v.VisitParameter(n)
+	case *SubroutineBody:
+		return t.v.VisitSubroutineBody(n)
+	case *VarDec:
+		return t.v.VisitVarDec(n)
+	case *LetStatement:
+		return t.v.VisitLetStatement(n)
+	case *IfStatement:
+		return t.v.VisitIfStatement(n)
+	case *WhileStatement:
+		return t.v.VisitWhileStatement(n)
+	case *DoStatement:
+		return t.v.VisitDoStatement(n)
+	case *ReturnStatement:
+		return t.v.VisitReturnStatement(n)
+	case *BinaryExpression:
+		return t.v.VisitBinaryExpression(n)
+	case *UnaryExpression:
+		return t.v.VisitUnaryExpression(n)
+	case *ParenExpression:
+		return t.v.VisitParenExpression(n)
+	case *VarRef:
+		return t.v.VisitVarRef(n)
+	case *ArrayAccess:
+		return t.v.VisitArrayAccess(n)
+	case *SubroutineCall:
+		return t.v.VisitSubroutineCall(n)
+	case *Identifier:
+		return t.v.VisitIdentifier(n)
+	case *Type:
+		return t.v.VisitType(n)
+	case *IntegerConstant:
+		return t.v.VisitIntegerConstant(n)
+	case *StringConstant:
+		return t.v.VisitStringConstant(n)
+	case *KeywordConstant:
+		return t.v.VisitKeywordConstant(n)
+	}
+	panic(fmt.Sprintf("unknown node %T", n))
+}
+
+func (t typedVisitor) Post(n Node) {
+	switch n := n.(type) {
+	case *Class:
+		t.v.LeaveClass(n)
+	case *ClassVarDec:
+		t.v.LeaveClassVarDec(n)
+	case *SubroutineDec:
+		t.v.LeaveSubroutineDec(n)
+	case *Parameter:
+		t.v.LeaveParameter(n)
+	case *SubroutineBody:
+		t.v.LeaveSubroutineBody(n)
+	case *VarDec:
+		t.v.LeaveVarDec(n)
+	case *LetStatement:
+		t.v.LeaveLetStatement(n)
+	case *IfStatement:
+		t.v.LeaveIfStatement(n)
+	case *WhileStatement:
+		t.v.LeaveWhileStatement(n)
+	case *DoStatement:
+		t.v.LeaveDoStatement(n)
+	case *ReturnStatement:
+		t.v.LeaveReturnStatement(n)
+	case *BinaryExpression:
+		t.v.LeaveBinaryExpression(n)
+	case *UnaryExpression:
+		t.v.LeaveUnaryExpression(n)
+	case *ParenExpression:
+		t.v.LeaveParenExpression(n)
+	case *VarRef:
+		t.v.LeaveVarRef(n)
+	case *ArrayAccess:
+		t.v.LeaveArrayAccess(n)
+	case *SubroutineCall:
+		t.v.LeaveSubroutineCall(n)
+	case *Identifier:
+		t.v.LeaveIdentifier(n)
+	case *Type:
+		t.v.LeaveType(n)
+	case *IntegerConstant:
+		t.v.LeaveIntegerConstant(n)
+	case *StringConstant:
+		t.v.LeaveStringConstant(n)
+	case *KeywordConstant:
+		t.v.LeaveKeywordConstant(n)
+	default:
+		panic(fmt.Sprintf("unknown node %T", n))
+	}
+}
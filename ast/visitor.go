@@ -0,0 +1,325 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/*
+Walking and rewriting the syntax tree, for checks and transformations that
+live outside the compiler
+*/
+
+// Visitor is called by Walk for every node of a tree. Pre is called before
+// the children of the node and Post after them; when Pre returns false the
+// children and Post are skipped. A type switch on the node picks the hooks
+// for each kind of node; a TypedVisitor given to WalkTyped has one per node
+// type instead
+type Visitor interface {
+	Pre(n Node) bool
+	Post(n Node)
+}
+
+// Walk visits n and everything below it in source order. The parts a syntax
+// error left out of a tree, such as the name of a class without one, are
+// skipped
+func Walk(v Visitor, n Node) {
+	if isMissing(n) || !v.Pre(n) {
+		return
+	}
+	switch n := n.(type) {
+	case *Class:
+		Walk(v, n.Name)
+		for _, dec := range n.VarDecs {
+			Walk(v, dec)
+		}
+		for _, sub := range n.Subroutines {
+			Walk(v, sub)
+		}
+	case *ClassVarDec:
+		Walk(v, n.Type)
+		walkIdentifiers(v, n.Names)
+	case *SubroutineDec:
+		Walk(v, n.ReturnType)
+		Walk(v, n.Name)
+		for _, param := range n.Params {
+			Walk(v, param)
+		}
+		Walk(v, n.Body)
+	case *Parameter:
+		Walk(v, n.Type)
+		Walk(v, n.Name)
+	case *SubroutineBody:
+		for _, dec := range n.VarDecs {
+			Walk(v, dec)
+		}
+		walkStatements(v, n.Statements)
+	case *VarDec:
+		Walk(v, n.Type)
+		walkIdentifiers(v, n.Names)
+
+	case *LetStatement:
+		Walk(v, n.Name)
+		if n.Index != nil {
+			Walk(v, n.Index)
+		}
+		Walk(v, n.Value)
+	case *IfStatement:
+		Walk(v, n.Condition)
+		walkStatements(v, n.Then)
+		walkStatements(v, n.Else)
+	case *WhileStatement:
+		Walk(v, n.Condition)
+		walkStatements(v, n.Body)
+	case *DoStatement:
+		Walk(v, n.Call)
+	case *ReturnStatement:
+		if n.Value != nil {
+			Walk(v, n.Value)
+		}
+
+	case *BinaryExpression:
+		walkOperands(v, n)
+	case *UnaryExpression:
+		Walk(v, n.Operand)
+	case *ParenExpression:
+		Walk(v, n.Inner)
+	case *VarRef:
+		Walk(v, n.Name)
+	case *ArrayAccess:
+		Walk(v, n.Name)
+		Walk(v, n.Index)
+	case *SubroutineCall:
+		if n.Receiver != nil {
+			Walk(v, n.Receiver)
+		}
+		Walk(v, n.Name)
+		for _, arg := range n.Args {
+			Walk(v, arg)
+		}
+	case *Identifier, *Type, *IntegerConstant, *StringConstant, *KeywordConstant:
+	default:
+		panic(fmt.Sprintf("unknown node %T", n))
+	}
+	v.Post(n)
+}
+
+// isMissing tells whether n is a child the parser did not fill in, a nil
+// interface or a nil pointer to a node
+func isMissing(n Node) bool {
+	if n == nil {
+		return true
+	}
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// walkOperands walks the operands of a binary expression along its Chain,
+// calling Pre on the operators of the chain from the outermost in as Walk
+// would; Walk has called it on n already
+func walkOperands(v Visitor, n *BinaryExpression) {
+	first, ops := Chain(n)
+	inner := len(ops) - 1
+	for inner > 0 && v.Pre(ops[inner-1]) {
+		inner--
+	}
+	if inner == 0 {
+		Walk(v, first)
+	}
+	for i := inner; i < len(ops); i++ {
+		Walk(v, ops[i].Right)
+		if i < len(ops)-1 {
+			v.Post(ops[i])
+		}
+	}
+}
+
+func walkIdentifiers(v Visitor, names []*Identifier) {
+	for _, name := range names {
+		Walk(v, name)
+	}
+}
+
+func walkStatements(v Visitor, statements []Statement) {
+	for _, statement := range statements {
+		Walk(v, statement)
+	}
+}
+
+// inspector is a Visitor with only a Pre hook
+type inspector func(Node) bool
+
+func (f inspector) Pre(n Node) bool {
+	return f(n)
+}
+
+func (f inspector) Post(Node) {}
+
+// Inspect calls f for n and everything below it in source order, skipping
+// the children of the nodes it returns false for
+func Inspect(n Node, f func(Node) bool) {
+	Walk(inspector(f), n)
+}
+
+// Rewriter is called by Rewrite for every node of a tree, after the children
+// of the node were rewritten. What it returns takes the place of the node, so
+// returning the node itself keeps it. The replacement must fit where the node
+// was: a statement for a statement, an expression for an expression, and the
+// same type for everything else. A statement can also be replaced by nil,
+// which removes it from its block
+type Rewriter interface {
+	Rewrite(n Node) Node
+}
+
+// RewriteFunc is a Rewriter made of a function
+type RewriteFunc func(Node) Node
+
+func (f RewriteFunc) Rewrite(n Node) Node {
+	return f(n)
+}
+
+// Rewrite rewrites n and everything below it bottom up, changing the tree in
+// place, and returns what replaced n. Missing parts of a tree with syntax
+// errors stay missing, the Rewriter is not called for them
+func Rewrite(r Rewriter, n Node) Node {
+	if isMissing(n) {
+		return n
+	}
+	switch n := n.(type) {
+	case *Class:
+		n.Name = rewriteAs(r, n.Name)
+		for i, dec := range n.VarDecs {
+			n.VarDecs[i] = rewriteAs(r, dec)
+		}
+		for i, sub := range n.Subroutines {
+			n.Subroutines[i] = rewriteAs(r, sub)
+		}
+	case *ClassVarDec:
+		n.Type = rewriteAs(r, n.Type)
+		rewriteIdentifiers(r, n.Names)
+	case *SubroutineDec:
+		n.ReturnType = rewriteAs(r, n.ReturnType)
+		n.Name = rewriteAs(r, n.Name)
+		for i, param := range n.Params {
+			n.Params[i] = rewriteAs(r, param)
+		}
+		n.Body = rewriteAs(r, n.Body)
+	case *Parameter:
+		n.Type = rewriteAs(r, n.Type)
+		n.Name = rewriteAs(r, n.Name)
+	case *SubroutineBody:
+		for i, dec := range n.VarDecs {
+			n.VarDecs[i] = rewriteAs(r, dec)
+		}
+		n.Statements = rewriteStatements(r, n.Statements)
+	case *VarDec:
+		n.Type = rewriteAs(r, n.Type)
+		rewriteIdentifiers(r, n.Names)
+
+	case *LetStatement:
+		n.Name = rewriteAs(r, n.Name)
+		if n.Index != nil {
+			n.Index = rewriteExpression(r, n.Index)
+		}
+		n.Value = rewriteExpression(r, n.Value)
+	case *IfStatement:
+		n.Condition = rewriteExpression(r, n.Condition)
+		n.Then = rewriteStatements(r, n.Then)
+		n.Else = rewriteStatements(r, n.Else)
+	case *WhileStatement:
+		n.Condition = rewriteExpression(r, n.Condition)
+		n.Body = rewriteStatements(r, n.Body)
+	case *DoStatement:
+		n.Call = rewriteAs(r, n.Call)
+	case *ReturnStatement:
+		if n.Value != nil {
+			n.Value = rewriteExpression(r, n.Value)
+		}
+
+	case *BinaryExpression:
+		rewriteOperands(r, n)
+	case *UnaryExpression:
+		n.Operand = rewriteExpression(r, n.Operand)
+	case *ParenExpression:
+		n.Inner = rewriteExpression(r, n.Inner)
+	case *VarRef:
+		n.Name = rewriteAs(r, n.Name)
+	case *ArrayAccess:
+		n.Name = rewriteAs(r, n.Name)
+		n.Index = rewriteExpression(r, n.Index)
+	case *SubroutineCall:
+		if n.Receiver != nil {
+			n.Receiver = rewriteAs(r, n.Receiver)
+		}
+		n.Name = rewriteAs(r, n.Name)
+		for i, arg := range n.Args {
+			n.Args[i] = rewriteExpression(r, arg)
+		}
+	case *Identifier, *Type, *IntegerConstant, *StringConstant, *KeywordConstant:
+	default:
+		panic(fmt.Sprintf("unknown node %T", n))
+	}
+	return r.Rewrite(n)
+}
+
+// rewriteAs rewrites n, whose replacement must have the same type
+func rewriteAs[T Node](r Rewriter, n T) T {
+	replaced := Rewrite(r, n)
+	same, ok := replaced.(T)
+	if !ok {
+		panic(fmt.Sprintf("%T rewritten to %T", n, replaced))
+	}
+	return same
+}
+
+func rewriteIdentifiers(r Rewriter, names []*Identifier) {
+	for i, name := range names {
+		names[i] = rewriteAs(r, name)
+	}
+}
+
+func rewriteExpression(r Rewriter, expr Expression) Expression {
+	if expr == nil {
+		return nil
+	}
+	return asExpression(expr, Rewrite(r, expr))
+}
+
+func asExpression(expr Expression, replaced Node) Expression {
+	e, ok := replaced.(Expression)
+	if !ok {
+		panic(fmt.Sprintf("expression %T rewritten to %T", expr, replaced))
+	}
+	return e
+}
+
+// rewriteOperands rewrites the operands of a binary expression along its
+// Chain, and the operators of the chain below n; Rewrite rewrites n itself
+func rewriteOperands(r Rewriter, n *BinaryExpression) {
+	first, ops := Chain(n)
+	left := rewriteExpression(r, first)
+	for i, op := range ops {
+		op.Left = left
+		op.Right = rewriteExpression(r, op.Right)
+		if i < len(ops)-1 {
+			left = asExpression(op, r.Rewrite(op))
+		}
+	}
+}
+
+// rewriteStatements rewrites a block, leaving out the statements replaced by nil
+func rewriteStatements(r Rewriter, statements []Statement) []Statement {
+	kept := statements[:0]
+	for _, statement := range statements {
+		replaced := Rewrite(r, statement)
+		if replaced == nil {
+			continue
+		}
+		s, ok := replaced.(Statement)
+		if !ok {
+			panic(fmt.Sprintf("statement %T rewritten to %T", statement, replaced))
+		}
+		kept = append(kept, s)
+	}
+	return kept
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	"compiler/ast"
+	"compiler/lexer"
+	"compiler/parser"
+	"compiler/token"
+)
+
+func parse(t *testing.T, src string) *ast.Class {
+	t.Helper()
+	return parser.New(lexer.New(strings.NewReader(src), "Main.jack")).CompileClass()
+}
+
+func TestParseClass(t *testing.T) {
+	class := parse(t, `class Main {
+    static int count;
+    field Array a, b;
+
+    method void run(int x, Point p) {
+        var int i;
+        let a[i] = x + 1;
+        if (x) { return; } else { do p.move(1, -x); }
+        while (~(i = 0)) { let i = i - 1; }
+        return this;
+    }
+}`)
+	if class.Name.Name != "Main" || len(class.VarDecs) != 2 || len(class.Subroutines) != 1 {
+		t.Fatalf("class %s has %d var decs and %d subroutines", class.Name.Name, len(class.VarDecs), len(class.Subroutines))
+	}
+	if dec := class.VarDecs[1]; dec.Kind != token.KeywordField || dec.Type.Name != "Array" || len(dec.Names) != 2 || dec.Names[1].Name != "b" {
+		t.Errorf("field declaration parsed as %+v", dec)
+	}
+
+	run := class.Subroutines[0]
+	if run.Kind != token.KeywordMethod || run.ReturnType.Name != "void" || len(run.Params) != 2 || run.Params[1].Type.Name != "Point" {
+		t.Errorf("method parsed as %+v", run)
+	}
+	if pos := run.Pos(); pos.Line != 5 || pos.Column != 5 {
+		t.Errorf("method at %s, want 5:5", pos)
+	}
+	statements := run.Body.Statements
+	if len(run.Body.VarDecs) != 1 || len(statements) != 4 {
+		t.Fatalf("body has %d var decs and %d statements", len(run.Body.VarDecs), len(statements))
+	}
+
+	let := statements[0].(*ast.LetStatement)
+	if let.Index == nil || let.Value.(*ast.BinaryExpression).Op != token.SymbolPlus {
+		t.Errorf("let parsed as %+v", let)
+	}
+	ifStmt := statements[1].(*ast.IfStatement)
+	if !ifStmt.HasElse || len(ifStmt.Then) != 1 || len(ifStmt.Else) != 1 {
+		t.Fatalf("if parsed as %+v", ifStmt)
+	}
+	call := ifStmt.Else[0].(*ast.DoStatement).Call
+	if call.Receiver.Name != "p" || call.Name.Name != "move" || len(call.Args) != 2 {
+		t.Errorf("call parsed as %+v", call)
+	}
+	if _, ok := call.Args[1].(*ast.UnaryExpression); !ok {
+		t.Errorf("second argument parsed as %T", call.Args[1])
+	}
+	while := statements[2].(*ast.WhileStatement)
+	if not, ok := while.Condition.(*ast.UnaryExpression); !ok || not.Op != token.SymbolTilde {
+		t.Errorf("while condition parsed as %T", while.Condition)
+	}
+	if ret := statements[3].(*ast.ReturnStatement); ret.Value.(*ast.KeywordConstant).Value != token.KeywordThis {
+		t.Errorf("return parsed as %+v", ret)
+	}
+}
+
+func TestParseExpressionNestsToTheLeft(t *testing.T) {
+	class := parse(t, "class Main { function int f() { return 1 + g() * a[2]; } }")
+	ret := class.Subroutines[0].Body.Statements[0].(*ast.ReturnStatement)
+	mul, ok := ret.Value.(*ast.BinaryExpression)
+	if !ok || mul.Op != token.SymbolStar {
+		t.Fatalf("return value parsed as %+v", ret.Value)
+	}
+	add, ok := mul.Left.(*ast.BinaryExpression)
+	if !ok || add.Op != token.SymbolPlus {
+		t.Fatalf("left operand parsed as %+v", mul.Left)
+	}
+	if c, ok := add.Right.(*ast.SubroutineCall); !ok || c.Receiver != nil || c.Name.Name != "g" {
+		t.Errorf("g() parsed as %+v", add.Right)
+	}
+	if a, ok := mul.Right.(*ast.ArrayAccess); !ok || a.Name.Name != "a" || a.Index.(*ast.IntegerConstant).Value != 2 {
+		t.Errorf("a[2] parsed as %+v", mul.Right)
+	}
+}
+
+func parseErrors(src string) []string {
+	engine := parser.New(lexer.New(strings.NewReader(src), "Main.jack"))
+	engine.CompileClass()
+	errs := make([]string, 0, len(engine.Errors))
+	for _, d := range engine.Errors {
+		errs = append(errs, d.Error())
+	}
+	return errs
+}
+
+func TestParseReportsEverySyntaxError(t *testing.T) {
+	src := `class Main {
+    field int x y;
+    function void main() {
+        let i = ;
+        do Output.printInt(i;
+        if (i < ) { let i = 1; } else { let i = 2; }
+        foo bar;
+        let s = "abc
+        return @;
+    }
+    method int f( { return 1; }
+    function void g() {
+        return 1 +
+    }
+}`
+	want := []string{
+		"Main.jack:2:17: expected ; in classVarDec, found identifier y",
+		"Main.jack:4:17: expected a term in expression, found symbol ;",
+		"Main.jack:5:29: expected ) in subroutineCall, found symbol ;",
+		"Main.jack:6:17: expected a term in expression, found symbol )",
+		"Main.jack:7:9: expected a statement in statements, found identifier foo",
+		"Main.jack:8:21: newline in string constant",
+		"Main.jack:9:9: expected ; in letStatement, found keyword return",
+		"Main.jack:9:16: illegal character '@'",
+		"Main.jack:11:19: expected type in parameterList, found symbol {",
+		"Main.jack:14:5: expected a term in expression, found symbol }",
+	}
+	if got := parseErrors(src); !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseUnclosedClass(t *testing.T) {
+	for src, want := range map[string]string{
+		"class Main { function void f() { return; }":    "Main.jack:1:43: expected } in class, found end of file",
+		"class Main { function void f() { return; } }}": "Main.jack:1:45: expected end of file after the class, found symbol }",
+		"class Main { function void f() { return; ":     "Main.jack:1:42: expected } in subroutineBody, found end of file",
+		"Main { }": "Main.jack:1:1: expected class in class, found identifier Main",
+	} {
+		if got := parseErrors(src); len(got) != 1 || got[0] != want {
+			t.Errorf("%q: got %q, want %q", src, got, want)
+		}
+	}
+}
+
+// dropping any single token from a valid class must give an error, never a
+// hang or a crash
+func TestParseRecoversFromEveryMissingToken(t *testing.T) {
+	src := "/** Generated for benchmarks. */\nclass Bench {\n    field int x, y;\n    static Array cache;\n\n}\n"
+	tokenizer := lexer.New(strings.NewReader(src), "Main.jack")
+	texts := make([]string, 0)
+	for tok := tokenizer.Advance(); tok.Kind != lexer.TokenTypeEOF; tok = tokenizer.Advance() {
+		texts = append(texts, tok.Text)
+	}
+	if errs := parseErrors(src); len(errs) > 0 {
+		t.Fatalf("valid source has errors %q", errs)
+	}
+	for i := range texts {
+		broken := strings.Join(texts[:i], " ") + " " + strings.Join(texts[i+1:], " ")
+		if errs := parseErrors(broken); len(errs) == 0 && texts[i] != "-" && texts[i] != "~" {
+			t.Errorf("no error without token %d %q", i, texts[i])
+		}
+	}
+}
+
+func TestCompileWritesNothingOnErrors(t *testing.T) {
+	var out bytes.Buffer
+	errs := compile(lexer.New(strings.NewReader("class Main { function void f() { let x = 1 } }"), "Main.jack"), &out)
+	if len(errs) != 1 || out.Len() > 0 {
+		t.Errorf("got errors %v and output %q", errs, out.String())
+	}
+}
+
+func TestParseChecksEveryTerminal(t *testing.T) {
+	for _, test := range []struct {
+		src  string
+		want string
+	}{
+		{"function void f) { return; }", "1:29: expected ( in subroutineDec, found symbol )"},
+		{"function void f( { return; }", "1:31: expected type in parameterList, found symbol {"},
+		{"function void f() return; }", "1:32: expected { in subroutineBody, found keyword return"},
+		{"function f() { return; }", "1:24: expected subroutineName in subroutineDec, found symbol ("},
+		{"function void f(void x) { return; }", "1:30: expected type in parameterList, found keyword void"},
+		{"field void x; function void f() { return; }", "1:20: expected type in classVarDec, found keyword void"},
+		{"function void f() { if x) { } return; }", "1:37: expected ( in ifStatement, found identifier x"},
+		{"function void f() { if (x { } return; }", "1:40: expected ) in ifStatement, found symbol {"},
+		{"function void f() { if (x) } return; }", "1:41: expected { in ifStatement, found symbol }"},
+		{"function void f() { if (x) { } else return; }", "1:50: expected { in ifStatement, found keyword return"},
+		{"function void f() { while (x) let x = 1; }", "1:44: expected { in whileStatement, found keyword let"},
+		{"function void f() { while x) { } }", "1:40: expected ( in whileStatement, found identifier x"},
+		{"function void f() { do g; }", "1:38: expected ( in subroutineCall, found symbol ;"},
+		{"function void f() { do g() }", "1:41: expected ; in doStatement, found symbol }"},
+		{"function void f() { do a.b.c(); }", "1:40: expected ( in subroutineCall, found symbol ."},
+		{"function void f() { do 3(); }", "1:37: expected subroutineName in subroutineCall, found integerConstant 3"},
+		{"function void f() { let x = let; }", "1:42: expected a term in expression, found keyword let"},
+		{"function void f() { let x = g(1 2); }", "1:46: expected ) in subroutineCall, found integerConstant 2"},
+		{"function void f() { let x[1 = 2; }", "1:45: expected ] in letStatement, found symbol ;"},
+		{"function void f() { let x = -*2; }", "1:43: expected a term in term, found symbol *"},
+	} {
+		src := "class Main { " + test.src + " }"
+		if got := parseErrors(src); len(got) == 0 || got[0] != "Main.jack:"+test.want {
+			t.Errorf("%s: got %q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestTraceLogsRulesAndTokens(t *testing.T) {
+	var trace strings.Builder
+	engine := parser.New(lexer.New(strings.NewReader("class Main { field int x y; }"), "Main.jack"))
+	engine.TraceTo(&trace)
+	engine.CompileClass()
+	want := `class at Main.jack:1:1, keyword class
+  keyword class at Main.jack:1:1
+  identifier Main at Main.jack:1:7
+  symbol { at Main.jack:1:12
+  classVarDec at Main.jack:1:14, keyword field
+    keyword field at Main.jack:1:14
+    keyword int at Main.jack:1:20
+    identifier x at Main.jack:1:24
+    error Main.jack:1:26: expected ; in classVarDec, found identifier y
+  end classVarDec
+  skipping to the next statement or declaration
+  identifier y at Main.jack:1:26
+  symbol ; at Main.jack:1:27
+  symbol } at Main.jack:1:29
+end class
+`
+	if trace.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", trace.String(), want)
+	}
+}
+
+func TestParseLimitsNesting(t *testing.T) {
+	deep := "class Main { function void f() { let x = " + strings.Repeat("(", 100000) + "1" + strings.Repeat(")", 100000) + "; return; } }"
+	errs := parseErrors(deep)
+	if len(errs) != 1 || errs[0] != "Main.jack:1:539: nested more than 1000 levels deep in expression" {
+		t.Errorf("got errors %q", errs)
+	}
+
+	blocks := "class Main { function void f() { " + strings.Repeat("while (x) { ", 600) + strings.Repeat("} ", 600) + "return; } }"
+	if errs := parseErrors(blocks); len(errs) != 1 || errs[0] != "Main.jack:1:6005: nested more than 1000 levels deep in expression" {
+		t.Errorf("got errors %q", errs)
+	}
+
+	shallow := "class Main { function void f() { let x = " + strings.Repeat("(", 100) + "1" + strings.Repeat(")", 100) + "; return; } }"
+	if errs := parseErrors(shallow); len(errs) > 0 {
+		t.Errorf("got errors %q", errs)
+	}
+}
+
+// any limit, even one that leaves no room for the class, ends the parse with
+// errors instead of a panic or an endless loop
+func TestParseWithSmallLimits(t *testing.T) {
+	src, err := os.ReadFile(filepath.Join("testdata", "Square", "SquareGame.jack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for limit := -1; limit <= 12; limit++ {
+		done := make(chan []token.Diagnostic)
+		go func() {
+			engine := parser.New(lexer.New(bytes.NewReader(src), "SquareGame.jack"))
+			engine.MaxDepth = limit
+			engine.CompileClass()
+			done <- engine.Errors
+		}()
+		select {
+		case errs := <-done:
+			if len(errs) == 0 {
+				t.Errorf("limit %d: no errors", limit)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("limit %d: the parse does not end", limit)
+		}
+	}
+}
+
+func TestLongUnaryChains(t *testing.T) {
+	src := "class Main { function int f(int x) { return " + strings.Repeat("-~", 50000) + "x; } }"
+	if errs := parseErrors(src); len(errs) != 1 || !strings.HasSuffix(errs[0], "nested more than 1000 levels deep in term") {
+		t.Errorf("got errors %q", errs)
+	}
+
+	engine := parser.New(lexer.New(strings.NewReader(src), "Main.jack"))
+	engine.MaxDepth = 200000
+	class := engine.CompileClass()
+	if len(engine.Errors) > 0 {
+		t.Fatal(engine.Errors)
+	}
+	buildResolver([]*ast.Class{class}, nil).resolveClass(class)
+	var out bytes.Buffer
+	buildCompilationEngine2(&out).compileClass(class)
+	if negs, nots := strings.Count(out.String(), "neg\n"), strings.Count(out.String(), "not\n"); negs != 50000 || nots != 50000 {
+		t.Errorf("got %d neg and %d not", negs, nots)
+	}
+	if !strings.Contains(out.String(), "not\nneg\nreturn\n") {
+		t.Errorf("outermost - is not the last operator")
+	}
+}
+
+// every backend follows a long chain of operators with ast.Chain, on a stack
+// far too small to recurse down it
+func TestLongOperatorChains(t *testing.T) {
+	const n = 10000
+	class := parse(t, "class Main { function int f(int x, boolean b) { return 1"+strings.Repeat("+x", n)+"+b; } }")
+	defer debug.SetMaxStack(debug.SetMaxStack(256 << 10))
+
+	resolver := buildResolver([]*ast.Class{class}, nil)
+	resolver.resolveClass(class)
+	if len(resolver.errors) != 0 {
+		t.Errorf("got %d resolve errors, first %s", len(resolver.errors), resolver.errors[0])
+	}
+	checker := buildTypeChecker([]*ast.Class{class}, true)
+	checker.checkClass(class)
+	if len(checker.errors) != 1 || checker.errors[0].Msg != "operand of + is boolean, want int" {
+		t.Errorf("got type errors %v", checker.errors)
+	}
+
+	var vm, xml, dot, astJSON, astSexp bytes.Buffer
+	buildCompilationEngine2(&vm).compileClass(class)
+	buildXMLWriter(&xml).writeClass(class, 0)
+	buildDotWriter(&dot).writeClass(class, "")
+	if err := dumpAST(class, &astJSON, "ast-json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dumpAST(class, &astSexp, "ast-sexp"); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name string
+		out  *bytes.Buffer
+		op   string
+	}{
+		{"vm", &vm, "add\n"},
+		{"xml", &xml, "<symbol> + </symbol>"},
+		{"dot", &dot, "shape=circle"},
+		{"ast-json", &astJSON, `"kind": "operator"`},
+		{"ast-sexp", &astSexp, `(operator "+"`},
+	} {
+		if got := strings.Count(c.out.String(), c.op); got != n+1 {
+			t.Errorf("%s has %d operators", c.name, got)
+		}
+	}
+
+	var rec recorder
+	ast.Walk(&rec, class.Subroutines[0].Body.Statements[0].(*ast.ReturnStatement).Value)
+	if len(rec.seen) != 2*(3*n+4) || rec.seen[n+1] != "+IntegerConstant" || rec.seen[len(rec.seen)-1] != "-BinaryExpression" {
+		t.Errorf("got %d visits, %s at %d", len(rec.seen), rec.seen[n+1], n+1)
+	}
+	renamed := 0
+	ast.Rewrite(ast.RewriteFunc(func(n ast.Node) ast.Node {
+		if id, ok := n.(*ast.Identifier); ok && id.Name == "x" {
+			renamed++
+			return &ast.Identifier{Span: id.Span, Name: "y"}
+		}
+		return n
+	}), class)
+	if renamed != n+1 {
+		t.Errorf("renamed %d identifiers", renamed)
+	}
+}
+
+func TestXMLUnaryTerms(t *testing.T) {
+	var out bytes.Buffer
+	buildXMLWriter(&out).writeTerm(parse(t, "class Main { function int f() { return -~x; } }").
+		Subroutines[0].Body.Statements[0].(*ast.ReturnStatement).Value, 0)
+	want := `<term>
+  <symbol> - </symbol>
+  <term>
+    <symbol> ~ </symbol>
+    <term>
+      <identifier> x </identifier>
+    </term>
+  </term>
+</term>
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestLexSkipsLongRunsOfIllegalCharacters(t *testing.T) {
+	errs := parseErrors("class Main { " + strings.Repeat("@", 100000) + " }")
+	if len(errs) != 100000 || errs[99999] != "Main.jack:1:100013: illegal character '@'" {
+		t.Errorf("got %d errors, the last %q", len(errs), errs[len(errs)-1])
+	}
+}
+
+// every node ends after it starts, and within its parent
+func TestEveryNodeHasASpan(t *testing.T) {
+	sources, _ := filepath.Glob(filepath.Join("testdata", "*", "*.jack"))
+	for _, source := range sources {
+		class := parser.New(buildTokenizer(source)).CompileClass()
+		parents := make([]ast.Node, 0)
+		ast.Walk(spanChecker{t: t, source: source, parents: &parents}, class)
+	}
+}
+
+type spanChecker struct {
+	t       *testing.T
+	source  string
+	parents *[]ast.Node
+}
+
+func (c spanChecker) Pre(n ast.Node) bool {
+	if n.End().Offset <= n.Pos().Offset {
+		c.t.Errorf("%s: %T at %s ends at %s", c.source, n, n.Pos(), n.End())
+	}
+	if len(*c.parents) > 0 {
+		parent := (*c.parents)[len(*c.parents)-1]
+		if n.Pos().Offset < parent.Pos().Offset || n.End().Offset > parent.End().Offset {
+			c.t.Errorf("%s: %T at %s-%s is outside %T at %s-%s", c.source, n, n.Pos(), n.End(), parent, parent.Pos(), parent.End())
+		}
+	}
+	*c.parents = append(*c.parents, n)
+	return true
+}
+
+func (c spanChecker) Post(ast.Node) {
+	*c.parents = (*c.parents)[:len(*c.parents)-1]
+}
+
+func TestNodeAt(t *testing.T) {
+	class := parse(t, `class Main {
+    function int f(int x) {
+        let x = g(x + 1, 2);
+        return x;
+    }
+}`)
+	for _, test := range []struct {
+		line, column int
+		want         string
+	}{
+		{1, 1, "*ast.Class"},
+		{1, 8, "*ast.Identifier Main"},
+		{2, 5, "*ast.SubroutineDec"},
+		{2, 24, "*ast.Identifier x"},
+		{2, 22, "*ast.Type"},
+		{3, 9, "*ast.LetStatement"},
+		{3, 17, "*ast.Identifier g"},
+		{3, 19, "*ast.Identifier x"},
+		{3, 21, "*ast.BinaryExpression"},
+		{3, 26, "*ast.IntegerConstant"},
+		{3, 27, "*ast.SubroutineCall"},
+		{3, 28, "*ast.LetStatement"},
+		{4, 20, "*ast.SubroutineBody"},
+		{6, 1, "*ast.Class"},
+	} {
+		got := "<nil>"
+		if n := ast.NodeAt(class, token.Position{Line: test.line, Column: test.column}); n != nil {
+			got = fmt.Sprintf("%T", n)
+			if id, ok := n.(*ast.Identifier); ok {
+				got += " " + id.Name
+			}
+		}
+		if got != test.want {
+			t.Errorf("%d:%d: got %s, want %s", test.line, test.column, got, test.want)
+		}
+	}
+	if n := ast.NodeAt(class, token.Position{Line: 6, Column: 2}); n != nil {
+		t.Errorf("after the class: got %T", n)
+	}
+}
+
+// an editor asks for nodes in code that does not parse yet
+func TestNodeAtWithSyntaxErrors(t *testing.T) {
+	engine := parser.New(lexer.New(strings.NewReader("class {\n    field int x;\n    function void f() { let = 1; return x; }\n}"), "Main.jack"))
+	class := engine.CompileClass()
+	if len(engine.Errors) == 0 || class.Name != nil {
+		t.Fatalf("class name %v, errors %v", class.Name, engine.Errors)
+	}
+	if n, ok := ast.NodeAt(class, token.Position{Line: 2, Column: 15}).(*ast.Identifier); !ok || n.Name != "x" {
+		t.Errorf("got %v, want field x", n)
+	}
+	if n := ast.NodeAt(class, token.Position{Line: 1, Column: 3}); n != class {
+		t.Errorf("got %T, want the class", n)
+	}
+	ast.Rewrite(ast.RewriteFunc(func(n ast.Node) ast.Node { return n }), class)
+}
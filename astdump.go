@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"compiler/ast"
+)
+
+/*
+Syntax tree dump, the whole tree of a class as JSON or as S-expressions for
+tools written in other languages
+*/
+
+// astDumpVersion changes whenever the shape of the dump changes, so that
+// scripts reading it can tell. Version 2 dumps a chain of operators as one
+// binaryExpression with a flat list of operands and operators
+const astDumpVersion = 2
+
+// dumpFile is the top of the JSON dump
+type dumpFile struct {
+	Version int       `json:"version"`
+	File    string    `json:"file"`
+	Class   *dumpNode `json:"class"`
+}
+
+// dumpNode is one node of the tree, the same shape for every kind of node.
+// Field is the role of the node in its parent, like "condition" or "operand"
+type dumpNode struct {
+	Kind     string      `json:"kind"`
+	Field    string      `json:"field,omitempty"`
+	Value    *string     `json:"value,omitempty"`
+	Span     *dumpSpan   `json:"span,omitempty"`
+	Children []*dumpNode `json:"children,omitempty"`
+}
+
+// dumpSpan runs from the first byte of a node to the byte after it
+type dumpSpan struct {
+	Start dumpPos `json:"start"`
+	End   dumpPos `json:"end"`
+}
+
+type dumpPos struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// dumpAST writes class to out, format is "ast-json" or "ast-sexp"
+func dumpAST(class *ast.Class, out io.Writer, format string) error {
+	tree := buildDumpClass(class)
+	w := bufio.NewWriter(out)
+	switch format {
+	case "ast-json":
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(dumpFile{Version: astDumpVersion, File: class.Pos().File, Class: tree}); err != nil {
+			return err
+		}
+	case "ast-sexp":
+		_, _ = fmt.Fprintf(w, "(jack-ast %d %s\n  ", astDumpVersion, strconv.Quote(class.Pos().File))
+		writeSexp(w, tree, 1)
+		_, _ = w.WriteString(")\n")
+	}
+	return w.Flush()
+}
+
+func newDumpNode(kind string, n ast.Node) *dumpNode {
+	start, end := n.Pos(), n.End()
+	return &dumpNode{Kind: kind, Span: &dumpSpan{
+		Start: dumpPos{Offset: start.Offset, Line: start.Line, Column: start.Column},
+		End:   dumpPos{Offset: end.Offset, Line: end.Line, Column: end.Column},
+	}}
+}
+
+func (d *dumpNode) value(v string) *dumpNode {
+	d.Value = &v
+	return d
+}
+
+// add appends child to d as field, nil children are left out
+func (d *dumpNode) add(field string, child *dumpNode) {
+	if child == nil {
+		return
+	}
+	child.Field = field
+	d.Children = append(d.Children, child)
+}
+
+func buildDumpClass(class *ast.Class) *dumpNode {
+	d := newDumpNode("class", class)
+	d.add("name", buildDumpIdentifier(class.Name))
+	for _, dec := range class.VarDecs {
+		v := newDumpNode("classVarDec", dec).value(dec.Kind.String())
+		v.add("type", buildDumpType(dec.Type))
+		for _, name := range dec.Names {
+			v.add("name", buildDumpIdentifier(name))
+		}
+		d.add("varDec", v)
+	}
+	for _, sub := range class.Subroutines {
+		d.add("subroutine", buildDumpSubroutine(sub))
+	}
+	return d
+}
+
+func buildDumpSubroutine(sub *ast.SubroutineDec) *dumpNode {
+	d := newDumpNode("subroutineDec", sub).value(sub.Kind.String())
+	d.add("returnType", buildDumpType(sub.ReturnType))
+	d.add("name", buildDumpIdentifier(sub.Name))
+	for _, param := range sub.Params {
+		p := newDumpNode("parameter", param)
+		p.add("type", buildDumpType(param.Type))
+		p.add("name", buildDumpIdentifier(param.Name))
+		d.add("parameter", p)
+	}
+
+	body := newDumpNode("subroutineBody", sub.Body)
+	for _, dec := range sub.Body.VarDecs {
+		v := newDumpNode("varDec", dec)
+		v.add("type", buildDumpType(dec.Type))
+		for _, name := range dec.Names {
+			v.add("name", buildDumpIdentifier(name))
+		}
+		body.add("varDec", v)
+	}
+	for _, statement := range sub.Body.Statements {
+		body.add("statement", buildDumpStatement(statement))
+	}
+	d.add("body", body)
+	return d
+}
+
+// buildDumpStatements wraps the statements of a block, which has no span of
+// its own
+func buildDumpStatements(statements []ast.Statement) *dumpNode {
+	d := &dumpNode{Kind: "statements"}
+	for _, statement := range statements {
+		d.add("statement", buildDumpStatement(statement))
+	}
+	return d
+}
+
+func buildDumpStatement(statement ast.Statement) *dumpNode {
+	switch s := statement.(type) {
+	case *ast.LetStatement:
+		d := newDumpNode("letStatement", s)
+		d.add("name", buildDumpIdentifier(s.Name))
+		if s.Index != nil {
+			d.add("index", buildDumpExpression(s.Index))
+		}
+		d.add("value", buildDumpExpression(s.Value))
+		return d
+	case *ast.IfStatement:
+		d := newDumpNode("ifStatement", s)
+		d.add("condition", buildDumpExpression(s.Condition))
+		d.add("then", buildDumpStatements(s.Then))
+		if s.HasElse {
+			d.add("else", buildDumpStatements(s.Else))
+		}
+		return d
+	case *ast.WhileStatement:
+		d := newDumpNode("whileStatement", s)
+		d.add("condition", buildDumpExpression(s.Condition))
+		d.add("body", buildDumpStatements(s.Body))
+		return d
+	case *ast.DoStatement:
+		d := newDumpNode("doStatement", s)
+		d.add("call", buildDumpExpression(s.Call))
+		return d
+	case *ast.ReturnStatement:
+		d := newDumpNode("returnStatement", s)
+		if s.Value != nil {
+			d.add("value", buildDumpExpression(s.Value))
+		}
+		return d
+	}
+	panic(fmt.Sprintf("unknown statement %T", statement))
+}
+
+func buildDumpExpression(expr ast.Expression) *dumpNode {
+	switch e := expr.(type) {
+	case *ast.BinaryExpression:
+		// the chain is flat, operand (operator operand)*, so that the dump
+		// is no deeper for a long chain. An operator spans the expression it
+		// ends, from the first operand to its right operand
+		first, ops := ast.Chain(e)
+		d := newDumpNode("binaryExpression", e)
+		d.add("operand", buildDumpExpression(first))
+		for _, op := range ops {
+			d.add("operator", newDumpNode("operator", op).value(op.Op.String()))
+			d.add("operand", buildDumpExpression(op.Right))
+		}
+		return d
+	case *ast.UnaryExpression:
+		d := newDumpNode("unaryExpression", e).value(e.Op.String())
+		d.add("operand", buildDumpExpression(e.Operand))
+		return d
+	case *ast.ParenExpression:
+		d := newDumpNode("parenExpression", e)
+		d.add("inner", buildDumpExpression(e.Inner))
+		return d
+	case *ast.IntegerConstant:
+		return newDumpNode("integerConstant", e).value(strconv.Itoa(e.Value))
+	case *ast.StringConstant:
+		return newDumpNode("stringConstant", e).value(e.Value)
+	case *ast.KeywordConstant:
+		return newDumpNode("keywordConstant", e).value(e.Value.String())
+	case *ast.VarRef:
+		d := newDumpNode("varRef", e)
+		d.add("name", buildDumpIdentifier(e.Name))
+		return d
+	case *ast.ArrayAccess:
+		d := newDumpNode("arrayAccess", e)
+		d.add("name", buildDumpIdentifier(e.Name))
+		d.add("index", buildDumpExpression(e.Index))
+		return d
+	case *ast.SubroutineCall:
+		d := newDumpNode("subroutineCall", e)
+		if e.Receiver != nil {
+			d.add("receiver", buildDumpIdentifier(e.Receiver))
+		}
+		d.add("name", buildDumpIdentifier(e.Name))
+		for _, arg := range e.Args {
+			d.add("arg", buildDumpExpression(arg))
+		}
+		return d
+	}
+	panic(fmt.Sprintf("unknown expression %T", expr))
+}
+
+func buildDumpIdentifier(id *ast.Identifier) *dumpNode {
+	return newDumpNode("identifier", id).value(id.Name)
+}
+
+func buildDumpType(t *ast.Type) *dumpNode {
+	return newDumpNode("type", t).value(t.Name)
+}
+
+// writeSexp writes d as (kind "value" @line:col-line:col :field (child) ...).
+// Children without children of their own stay on the line of their parent
+// until the first child that needs lines of its own
+func writeSexp(w *bufio.Writer, d *dumpNode, depth int) {
+	writeSexpHead(w, d)
+	inline := true
+	for _, child := range d.Children {
+		inline = inline && len(child.Children) == 0
+		if inline {
+			_, _ = fmt.Fprintf(w, " :%s ", child.Field)
+			writeSexpHead(w, child)
+			_, _ = w.WriteString(")")
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "\n%s:%s ", strings.Repeat("  ", depth+1), child.Field)
+		writeSexp(w, child, depth+1)
+	}
+	_, _ = w.WriteString(")")
+}
+
+// writeSexpHead writes the open parenthesis, kind, value and span of d
+func writeSexpHead(w *bufio.Writer, d *dumpNode) {
+	_, _ = w.WriteString("(" + d.Kind)
+	if d.Value != nil {
+		_, _ = w.WriteString(" " + strconv.Quote(*d.Value))
+	}
+	if d.Span != nil {
+		_, _ = fmt.Fprintf(w, " @%d:%d-%d:%d", d.Span.Start.Line, d.Span.Start.Column, d.Span.End.Line, d.Span.End.Column)
+	}
+}
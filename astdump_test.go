@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestDumpASTJSON(t *testing.T) {
+	src := "class Main {\n  function int f(int x) {\n    return x + 1;\n  }\n}"
+	class := parse(t, src)
+	var out bytes.Buffer
+	if err := dumpAST(class, &out, "ast-json"); err != nil {
+		t.Fatal(err)
+	}
+	var file dumpFile
+	if err := json.Unmarshal(out.Bytes(), &file); err != nil {
+		t.Fatalf("%v in\n%s", err, out.String())
+	}
+	if file.Version != astDumpVersion || file.File != "Main.jack" || file.Class.Kind != "class" {
+		t.Fatalf("dump starts with %+v", file)
+	}
+	if end := file.Class.Span.End; end.Line != 5 || end.Column != 2 || end.Offset != len(src) {
+		t.Errorf("class ends at %+v", end)
+	}
+
+	sub := file.Class.Children[1]
+	if sub.Kind != "subroutineDec" || sub.Field != "subroutine" || *sub.Value != "function" {
+		t.Fatalf("second child of the class is %+v", sub)
+	}
+	body := sub.Children[3]
+	ret := body.Children[0]
+	sum := ret.Children[0]
+	if body.Kind != "subroutineBody" || ret.Kind != "returnStatement" || sum.Kind != "binaryExpression" || len(sum.Children) != 3 {
+		t.Fatalf("body dumped as %+v", body)
+	}
+	left, plus, right := sum.Children[0], sum.Children[1], sum.Children[2]
+	if left.Field != "operand" || left.Kind != "varRef" || plus.Field != "operator" || *plus.Value != "+" || right.Field != "operand" || *right.Value != "1" {
+		t.Errorf("x + 1 dumped as %+v, %+v and %+v", left, plus, right)
+	}
+	if span := plus.Span; span.Start.Line != 3 || span.Start.Column != 12 || span.End.Column != 17 {
+		t.Errorf("x + 1 spans %+v", span)
+	}
+}
+
+// a chain of operators is one node whatever its length
+func TestDumpASTOperatorChains(t *testing.T) {
+	class := parse(t, "class Main { function int f() { return 1 + 2 * 3; } }")
+	var out bytes.Buffer
+	if err := dumpAST(class, &out, "ast-sexp"); err != nil {
+		t.Fatal(err)
+	}
+	want := `(jack-ast 2 "Main.jack"
+  (class @1:1-1:54 :name (identifier "Main" @1:7-1:11)
+    :subroutine (subroutineDec "function" @1:14-1:52 :returnType (type "int" @1:23-1:26) :name (identifier "f" @1:27-1:28)
+      :body (subroutineBody @1:31-1:52
+        :statement (returnStatement @1:33-1:50
+          :value (binaryExpression @1:40-1:49 :operand (integerConstant "1" @1:40-1:41) :operator (operator "+" @1:40-1:45) :operand (integerConstant "2" @1:44-1:45) :operator (operator "*" @1:40-1:49) :operand (integerConstant "3" @1:48-1:49)))))))
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestDumpASTSexp(t *testing.T) {
+	class := parse(t, `class Main { function void f() { if (~b) { do Output.printString("hi"); } return; } }`)
+	var out bytes.Buffer
+	if err := dumpAST(class, &out, "ast-sexp"); err != nil {
+		t.Fatal(err)
+	}
+	want := `(jack-ast 2 "Main.jack"
+  (class @1:1-1:86 :name (identifier "Main" @1:7-1:11)
+    :subroutine (subroutineDec "function" @1:14-1:84 :returnType (type "void" @1:23-1:27) :name (identifier "f" @1:28-1:29)
+      :body (subroutineBody @1:32-1:84
+        :statement (ifStatement @1:34-1:74
+          :condition (unaryExpression "~" @1:38-1:40
+            :operand (varRef @1:39-1:40 :name (identifier "b" @1:39-1:40)))
+          :then (statements
+            :statement (doStatement @1:44-1:72
+              :call (subroutineCall @1:47-1:71 :receiver (identifier "Output" @1:47-1:53) :name (identifier "printString" @1:54-1:65) :arg (stringConstant "hi" @1:66-1:70)))))
+        :statement (returnStatement @1:75-1:82)))))
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"compiler/ast"
+)
+
+/*
+DotWriter draws the syntax tree of a class as a Graphviz graph: every statement
+is a cluster holding its expressions as operator trees, and the statements of
+a block are chained in the order they run
+*/
+
+type DotWriter struct {
+	Out io.Writer
+	ids int // nodes and clusters written so far
+}
+
+func buildDotWriter(out io.Writer) *DotWriter {
+	return &DotWriter{
+		Out: out,
+	}
+}
+
+// writeClass writes the whole class, or only the subroutine named only when
+// it is not empty. It returns false when the class has no such subroutine
+func (w *DotWriter) writeClass(class *ast.Class, only string) bool {
+	subs := class.Subroutines
+	if only != "" {
+		subs = nil
+		for _, sub := range class.Subroutines {
+			if sub.Name.Name == only {
+				subs = append(subs, sub)
+			}
+		}
+		if len(subs) == 0 {
+			return false
+		}
+	}
+
+	w.line(0, "digraph %s {", dotQuote(class.Name.Name))
+	w.line(1, "label=%s;", dotQuote("class "+class.Name.Name))
+	w.line(1, `node [fontname="monospace"];`)
+	w.line(1, `edge [fontname="monospace", fontsize=10];`)
+	if only == "" {
+		for _, dec := range class.VarDecs {
+			w.writeNode(1, fmt.Sprintf("%s %s %s", dec.Kind, dec.Type.Name, joinNames(dec.Names)), "note")
+		}
+	}
+	for _, sub := range subs {
+		w.writeSubroutine(sub, 1)
+	}
+	w.line(0, "}")
+	return true
+}
+
+func (w *DotWriter) writeSubroutine(sub *ast.SubroutineDec, depth int) {
+	params := make([]string, 0, len(sub.Params))
+	for _, param := range sub.Params {
+		params = append(params, param.Type.Name+" "+param.Name.Name)
+	}
+	w.line(depth, "subgraph %s {", w.cluster())
+	w.line(depth+1, "label=%s;", dotQuote(fmt.Sprintf("%s %s %s(%s)",
+		sub.Kind, sub.ReturnType.Name, sub.Name.Name, strings.Join(params, ", "))))
+
+	entry := sub.Name.Name
+	for _, dec := range sub.Body.VarDecs {
+		entry += fmt.Sprintf("\nvar %s %s", dec.Type.Name, joinNames(dec.Names))
+	}
+	w.writeStatements(w.writeNode(depth+1, entry, "Mdiamond"), "", sub.Body.Statements, depth+1)
+	w.line(depth, "}")
+}
+
+// writeStatements chains statements after the node from, the first edge is
+// labelled label. It returns the node of the last statement, or from when
+// there are none
+func (w *DotWriter) writeStatements(from string, label string, statements []ast.Statement, depth int) string {
+	for _, statement := range statements {
+		id := w.writeStatement(statement, depth)
+		w.writeEdge(depth, from, id, label)
+		from, label = id, ""
+	}
+	return from
+}
+
+// writeStatement writes a cluster for the statement and returns the node of
+// the statement in it
+func (w *DotWriter) writeStatement(statement ast.Statement, depth int) string {
+	w.line(depth, "subgraph %s {", w.cluster())
+	w.line(depth+1, `label=%s; style=rounded; color=gray;`, dotQuote(fmt.Sprintf("line %d", statement.Pos().Line)))
+	var id string
+	switch s := statement.(type) {
+	case *ast.LetStatement:
+		if s.Index != nil {
+			id = w.writeNode(depth+1, "let "+s.Name.Name+"[]", "box")
+			w.writeEdge(depth+1, id, w.writeExpression(s.Index, depth+1), "index")
+		} else {
+			id = w.writeNode(depth+1, "let "+s.Name.Name, "box")
+		}
+		w.writeEdge(depth+1, id, w.writeExpression(s.Value, depth+1), "value")
+	case *ast.IfStatement:
+		id = w.writeNode(depth+1, "if", "box")
+		w.writeEdge(depth+1, id, w.writeExpression(s.Condition, depth+1), "condition")
+		w.writeStatements(id, "then", s.Then, depth+1)
+		if s.HasElse {
+			w.writeStatements(id, "else", s.Else, depth+1)
+		}
+	case *ast.WhileStatement:
+		id = w.writeNode(depth+1, "while", "box")
+		w.writeEdge(depth+1, id, w.writeExpression(s.Condition, depth+1), "condition")
+		if last := w.writeStatements(id, "body", s.Body, depth+1); last != id {
+			w.line(depth+1, "%s -> %s [style=dashed];", last, id)
+		}
+	case *ast.DoStatement:
+		id = w.writeNode(depth+1, "do", "box")
+		w.writeEdge(depth+1, id, w.writeExpression(s.Call, depth+1), "")
+	case *ast.ReturnStatement:
+		id = w.writeNode(depth+1, "return", "box")
+		if s.Value != nil {
+			w.writeEdge(depth+1, id, w.writeExpression(s.Value, depth+1), "value")
+		}
+	}
+	w.line(depth, "}")
+	return id
+}
+
+// writeExpression writes the tree of an expression, operators over their
+// operands, and returns the node at its root
+func (w *DotWriter) writeExpression(expr ast.Expression, depth int) string {
+	switch e := expr.(type) {
+	case *ast.BinaryExpression:
+		// the operators of the chain from the root down, then the operands
+		first, ops := ast.Chain(e)
+		ids := make([]string, len(ops))
+		for i := len(ops) - 1; i >= 0; i-- {
+			ids[i] = w.writeNode(depth, ops[i].Op.String(), "circle")
+		}
+		left := w.writeExpression(first, depth)
+		for i, op := range ops {
+			w.writeEdge(depth, ids[i], left, "")
+			w.writeEdge(depth, ids[i], w.writeExpression(op.Right, depth), "")
+			left = ids[i]
+		}
+		return left
+	case *ast.UnaryExpression:
+		id := w.writeNode(depth, e.Op.String(), "circle")
+		w.writeEdge(depth, id, w.writeExpression(e.Operand, depth), "")
+		return id
+	case *ast.ParenExpression:
+		id := w.writeNode(depth, "( )", "circle")
+		w.writeEdge(depth, id, w.writeExpression(e.Inner, depth), "")
+		return id
+	case *ast.IntegerConstant:
+		return w.writeNode(depth, fmt.Sprint(e.Value), "plaintext")
+	case *ast.StringConstant:
+		return w.writeNode(depth, `"`+e.Value+`"`, "plaintext")
+	case *ast.KeywordConstant:
+		return w.writeNode(depth, e.Value.String(), "plaintext")
+	case *ast.VarRef:
+		return w.writeNode(depth, e.Name.Name, "ellipse")
+	case *ast.ArrayAccess:
+		id := w.writeNode(depth, e.Name.Name+"[ ]", "ellipse")
+		w.writeEdge(depth, id, w.writeExpression(e.Index, depth), "index")
+		return id
+	case *ast.SubroutineCall:
+		name := e.Name.Name
+		if e.Receiver != nil {
+			name = e.Receiver.Name + "." + name
+		}
+		id := w.writeNode(depth, name+"()", "ellipse")
+		for _, arg := range e.Args {
+			w.writeEdge(depth, id, w.writeExpression(arg, depth), "")
+		}
+		return id
+	}
+	panic(fmt.Sprintf("unknown expression %T", expr))
+}
+
+func (w *DotWriter) writeNode(depth int, label string, shape string) string {
+	w.ids++
+	id := fmt.Sprintf("n%d", w.ids)
+	w.line(depth, "%s [label=%s, shape=%s];", id, dotQuote(label), shape)
+	return id
+}
+
+func (w *DotWriter) writeEdge(depth int, from string, to string, label string) {
+	if label == "" {
+		w.line(depth, "%s -> %s;", from, to)
+	} else {
+		w.line(depth, "%s -> %s [label=%s];", from, to, dotQuote(label))
+	}
+}
+
+// cluster names a new subgraph, graphviz draws the ones named cluster* as boxes
+func (w *DotWriter) cluster() string {
+	w.ids++
+	return fmt.Sprintf("cluster_%d", w.ids)
+}
+
+func (w *DotWriter) line(depth int, format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(w.Out, "%s%s\n", strings.Repeat("  ", depth), fmt.Sprintf(format, args...))
+}
+
+// dotQuote quotes s as a graphviz string, where a newline starts a new line of
+// the label
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func joinNames(names []*ast.Identifier) string {
+	s := make([]string, 0, len(names))
+	for _, name := range names {
+		s = append(s, name.Name)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"compiler/lexer"
+)
+
+func TestDotDrawsOperatorTrees(t *testing.T) {
+	class := parse(t, `class Main {
+  function int f(int x) {
+    while (x > 0) { let x = x - 1; }
+    return 1 + x * 2;
+  }
+}`)
+	var out bytes.Buffer
+	if !buildDotWriter(&out).writeClass(class, "") {
+		t.Fatal("f not found")
+	}
+	want := `digraph "Main" {
+  label="class Main";
+  node [fontname="monospace"];
+  edge [fontname="monospace", fontsize=10];
+  subgraph cluster_1 {
+    label="function int f(int x)";
+    n2 [label="f", shape=Mdiamond];
+    subgraph cluster_3 {
+      label="line 3"; style=rounded; color=gray;
+      n4 [label="while", shape=box];
+      n5 [label=">", shape=circle];
+      n6 [label="x", shape=ellipse];
+      n5 -> n6;
+      n7 [label="0", shape=plaintext];
+      n5 -> n7;
+      n4 -> n5 [label="condition"];
+      subgraph cluster_8 {
+        label="line 3"; style=rounded; color=gray;
+        n9 [label="let x", shape=box];
+        n10 [label="-", shape=circle];
+        n11 [label="x", shape=ellipse];
+        n10 -> n11;
+        n12 [label="1", shape=plaintext];
+        n10 -> n12;
+        n9 -> n10 [label="value"];
+      }
+      n4 -> n9 [label="body"];
+      n9 -> n4 [style=dashed];
+    }
+    n2 -> n4;
+    subgraph cluster_13 {
+      label="line 4"; style=rounded; color=gray;
+      n14 [label="return", shape=box];
+      n15 [label="*", shape=circle];
+      n16 [label="+", shape=circle];
+      n17 [label="1", shape=plaintext];
+      n16 -> n17;
+      n18 [label="x", shape=ellipse];
+      n16 -> n18;
+      n15 -> n16;
+      n19 [label="2", shape=plaintext];
+      n15 -> n19;
+      n14 -> n15 [label="value"];
+    }
+    n4 -> n14;
+  }
+}
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestDotDrawsOneSubroutine(t *testing.T) {
+	src := `class Main {
+  field int n;
+  function void f() { return; }
+  function void g() { do Output.printString("C:\dir"); return; }
+}`
+	var out bytes.Buffer
+	buildDotWriter(&out).writeClass(parse(t, src), "g")
+	if got := out.String(); strings.Contains(got, `"f"`) || strings.Contains(got, "field int n") ||
+		!strings.Contains(got, `label="function void g()"`) {
+		t.Errorf("drew more or less than g:\n%s", got)
+	}
+	if !strings.Contains(out.String(), `[label="\"C:\\dir\"", shape=plaintext]`) {
+		t.Errorf("string constant not quoted:\n%s", out.String())
+	}
+
+	defer func(emitWas string, subroutineWas string) { *emit, *subroutine = emitWas, subroutineWas }(*emit, *subroutine)
+	*emit, *subroutine = "dot", "h"
+	out.Reset()
+	errs := compile(lexer.New(strings.NewReader(src), "Main.jack"), &out)
+	if len(errs) != 1 || errs[0].Error() != "Main.jack:1:7: no subroutine h in class Main" {
+		t.Errorf("got errors %v", errs)
+	}
+}
@@ -0,0 +1,566 @@
+// Package lexer splits Jack source into tokens, keeping the comments and
+// whitespace around them on request, and lexes a source again after an edit
+package lexer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"compiler/token"
+)
+
+var (
+	symbols    = []byte{'{', '}', '[', ']', '(', ')', '.', ',', ';', '+', '-', '*', '/', '&', '|', '<', '>', '=', '~'}
+	ops        = []token.SymbolChar{token.SymbolPlus, token.SymbolMinus, token.SymbolStar, token.SymbolSlash, token.SymbolAnd, token.SymbolOr, token.SymbolLt, token.SymbolGt, token.SymbolEq}
+	symbolsSet [256]bool
+	opsSet     = make(map[token.SymbolChar]bool)
+)
+
+const (
+	utf8BOM     = "\xef\xbb\xbf"
+	maxIntConst = 32767
+)
+
+func init() {
+	for _, b := range symbols {
+		symbolsSet[b] = true
+	}
+	for _, op := range ops {
+		opsSet[op] = true
+	}
+}
+
+type TokenKind int
+
+const (
+	TokenTypeKeyword TokenKind = iota
+	TokenTypeSymbol
+	TokenTypeIdentifier
+	TokenTypeIntConst
+	TokenTypeStringConst
+	TokenTypeEOF // past the end of the input
+)
+
+// String is the name the nand2tetris tools use for a token kind
+func (k TokenKind) String() string {
+	switch k {
+	case TokenTypeKeyword:
+		return "keyword"
+	case TokenTypeSymbol:
+		return "symbol"
+	case TokenTypeIdentifier:
+		return "identifier"
+	case TokenTypeIntConst:
+		return "integerConstant"
+	case TokenTypeStringConst:
+		return "stringConstant"
+	case TokenTypeEOF:
+		return "EOF"
+	}
+	return fmt.Sprintf("TokenKind(%d)", int(k))
+}
+
+// Token is one token of a Jack source file
+type Token struct {
+	Kind    TokenKind
+	Text    string           // as written in the source, string constants keep their quotes
+	Keyword token.Keyword    // which keyword, KeywordNone for other kinds
+	Symbol  token.SymbolChar // which symbol, 0 for other kinds
+	IntVal  int              // value of an integer constant
+	StrVal  string           // value of a string constant, without the quotes
+	Pos     token.Position
+
+	// only filled when the tokenizer keeps trivia. Trailing trivia is what
+	// follows the token on its own line, up to and including the line break,
+	// everything else before a token is its leading trivia
+	Leading  []Trivia
+	Trailing []Trivia
+}
+
+func (tok Token) String() string {
+	if tok.Kind == TokenTypeEOF {
+		return "end of file"
+	}
+	return fmt.Sprintf("%s %s", tok.Kind, tok.Text)
+}
+
+func (tok Token) IsSymbol(s token.SymbolChar) bool {
+	return tok.Kind == TokenTypeSymbol && tok.Symbol == s
+}
+
+func (tok Token) IsKeyword(k token.Keyword) bool {
+	return tok.Kind == TokenTypeKeyword && tok.Keyword == k
+}
+
+// End is the position right after the token, tokens never span lines
+func (tok Token) End() token.Position {
+	end := tok.Pos
+	end.Offset += len(tok.Text)
+	end.Column += len(tok.Text)
+	return end
+}
+
+// IsOp reports whether the token is a binary operator
+func (tok Token) IsOp() bool {
+	return tok.Kind == TokenTypeSymbol && opsSet[tok.Symbol]
+}
+
+type TriviaKind int
+
+const (
+	TriviaWhitespace   TriviaKind = iota // spaces, tabs, form feeds
+	TriviaNewline                        // \n, \r\n or \r
+	TriviaLineComment                    // `// ...` without the line break
+	TriviaBlockComment                   // `/* ... */`
+	TriviaDocComment                     // `/** ... */`
+	TriviaBOM                            // a UTF-8 byte order mark at the start of the file
+)
+
+// Trivia is source text between tokens that does not change the program
+type Trivia struct {
+	Kind TriviaKind
+	Text string
+	Pos  token.Position
+}
+
+// SourceText returns the token exactly as it was in the source, with its trivia
+func (tok Token) SourceText() string {
+	var b strings.Builder
+	for _, trivia := range tok.Leading {
+		b.WriteString(trivia.Text)
+	}
+	b.WriteString(tok.Text)
+	for _, trivia := range tok.Trailing {
+		b.WriteString(trivia.Text)
+	}
+	return b.String()
+}
+
+// Tokenizer splits a Jack source into tokens
+type Tokenizer struct {
+	// src is the input from offset base on, tokens and trivia are slices
+	// of it. It is all of the input unless it is streamed from r
+	src      string
+	base     int
+	cursor   int // index in src of the next byte to read
+	r        io.Reader
+	newline  int // index in src of its last \n, -1 when there is none
+	line     int
+	column   int
+	filePath string
+	ahead    []Token // tokens read by Peek and not consumed yet
+	curr     Token
+	prev     Token // the token before curr
+
+	// KeepTrivia attaches comments and whitespace to the tokens instead of
+	// dropping them, so the source can be rebuilt from the tokens
+	KeepTrivia bool
+	trivia     []Trivia // Leading and Trailing of the tokens are cut from this
+
+	// OnError, when set, is given the lexical errors instead of a panic. The
+	// bad input is skipped and lexing goes on
+	OnError func(token.Diagnostic)
+	// OnConsume, when set, is given every token Advance moves past
+	OnConsume func(Token)
+}
+
+// New reads tokens from r, name is used as the file in positions.
+// Every token is a slice of the input read into memory, which keeps lexing
+// free of per-token allocations. A file or a reader of known length is read
+// at once; any other reader, like stdin or a pipe, is streamed a line at a
+// time, so that its tokens and errors come as soon as their line is read
+func New(r io.Reader, name string) *Tokenizer {
+	t := &Tokenizer{
+		newline:  -1,
+		line:     1,
+		column:   1,
+		filePath: name,
+	}
+	size := -1
+	switch r := r.(type) {
+	case *os.File:
+		if info, err := r.Stat(); err == nil && info.Mode().IsRegular() {
+			size = int(info.Size())
+		}
+	case interface{ Len() int }:
+		size = r.Len()
+	}
+	if size < 0 {
+		t.r = r
+		return t
+	}
+	var src strings.Builder
+	src.Grow(size)
+	if _, err := io.Copy(&src, r); err != nil {
+		panic(err)
+	}
+	t.src = src.String()
+	return t
+}
+
+// streamChunk is the least a streamed tokenizer asks its reader for at once
+const streamChunk = 4096
+
+// fillLine reads the input of a streamed tokenizer up to the end of the line
+// of the cursor, or to the end of the input. No token other than a block
+// comment spans lines, so the lexer can read the line as if it had all the
+// input. What is before the cursor has been lexed and is dropped
+func (t *Tokenizer) fillLine() {
+	for t.r != nil && t.cursor > t.newline {
+		t.base += t.cursor
+		t.newline -= t.cursor
+		t.src = t.src[t.cursor:]
+		t.cursor = 0
+		t.read()
+	}
+}
+
+// fillUntil reads the input of a streamed tokenizer until s is in src from
+// index from on, or the input ends
+func (t *Tokenizer) fillUntil(from int, s string) {
+	for t.r != nil && !strings.Contains(t.src[from:], s) {
+		t.read()
+	}
+}
+
+// read appends what the reader has now to src, at least one byte unless the
+// input has ended
+func (t *Tokenizer) read() {
+	// reading at least as much as is kept keeps the copies linear in the
+	// length of a long block comment
+	chunk := make([]byte, streamChunk+len(t.src))
+	n, err := io.ReadAtLeast(t.r, chunk, 1)
+	if n > 0 {
+		if i := bytes.LastIndexByte(chunk[:n], '\n'); i >= 0 {
+			t.newline = len(t.src) + i
+		}
+		t.src += string(chunk[:n])
+	}
+	switch err {
+	case nil:
+	case io.EOF, io.ErrUnexpectedEOF:
+		t.r = nil
+	default:
+		panic(err)
+	}
+}
+
+// hasMoreTokens reports whether the current token is still valid or there are
+// more tokens to read
+func (t *Tokenizer) hasMoreTokens() bool {
+	return t.curr.Text != "" || t.Peek(1).Kind != TokenTypeEOF
+}
+
+// maxLookahead is how far Peek can look, the grammar needs one token and the
+// tokens looked at are kept in memory until they are consumed
+const maxLookahead = 8
+
+// Peek returns the n-th token after the current one without consuming it,
+// Peek(1) is the token the next Advance moves to. n must be in
+// 1..maxLookahead. Past the end of the input the token is TokenTypeEOF
+func (t *Tokenizer) Peek(n int) Token {
+	if n < 1 || n > maxLookahead {
+		panic(fmt.Sprintf("peek(%d) is outside the lookahead 1..%d", n, maxLookahead))
+	}
+	for len(t.ahead) < n {
+		t.ahead = append(t.ahead, Token{})
+		t.lex(&t.ahead[len(t.ahead)-1])
+	}
+	return t.ahead[n-1]
+}
+
+// pos is the position of the cursor
+func (t *Tokenizer) pos() token.Position {
+	return token.Position{
+		File:   t.filePath,
+		Offset: t.base + t.cursor,
+		Line:   t.line,
+		Column: t.column,
+	}
+}
+
+// peekByte returns the byte n bytes after the cursor, or 0 at the end of the input
+func (t *Tokenizer) peekByte(n int) byte {
+	if t.cursor+n >= len(t.src) {
+		return 0
+	}
+	return t.src[t.cursor+n]
+}
+
+// next moves the cursor forward by one byte and keeps line and column in sync.
+// A line ends with \n, \r\n or a lone \r
+func (t *Tokenizer) next() {
+	curByte := t.src[t.cursor]
+	t.cursor += 1
+	if curByte == '\n' || (curByte == '\r' && t.peekByte(0) != '\n') {
+		t.line += 1
+		t.column = 1
+	} else {
+		t.column += 1
+	}
+}
+
+// skip moves the cursor forward by n bytes that do not contain a line break
+func (t *Tokenizer) skip(n int) {
+	t.cursor += n
+	t.column += n
+}
+
+func (t *Tokenizer) errorf(pos token.Position, format string, args ...interface{}) {
+	d := token.Diagnostic{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+	if t.OnError == nil {
+		panic(d)
+	}
+	t.OnError(d)
+}
+
+// scanTrivia moves the cursor over whitespace, `//` line comments and
+// `/* */`, `/** */` block comments. With stopAtNewline it stops after the
+// first line break. The trivia is only returned when the tokenizer keeps it
+func (t *Tokenizer) scanTrivia(stopAtNewline bool) []Trivia {
+	if t.KeepTrivia && cap(t.trivia)-len(t.trivia) < 64 {
+		// the slices handed out keep the old chunk alive, start a new one
+		t.trivia = make([]Trivia, 0, 4096)
+	}
+	first := len(t.trivia)
+	for t.fillLine(); t.cursor < len(t.src); t.fillLine() {
+		start := t.cursor
+		startLine, startColumn := t.line, t.column
+		var triviaKind TriviaKind
+		curByte := t.src[t.cursor]
+		switch {
+		case isWhitespace(curByte):
+			end := t.cursor + 1
+			for end < len(t.src) && isWhitespace(t.src[end]) {
+				end++
+			}
+			t.skip(end - t.cursor)
+			triviaKind = TriviaWhitespace
+		case curByte == '\n' || curByte == '\r':
+			if curByte == '\r' && t.peekByte(1) == '\n' {
+				t.cursor += 1
+			}
+			t.next()
+			triviaKind = TriviaNewline
+		case curByte == '/' && t.peekByte(1) == '/':
+			end := strings.IndexAny(t.src[t.cursor:], "\r\n")
+			if end < 0 {
+				end = len(t.src) - t.cursor
+			}
+			t.skip(end)
+			triviaKind = TriviaLineComment
+		case curByte == '/' && t.peekByte(1) == '*':
+			triviaKind = TriviaBlockComment
+			if t.peekByte(2) == '*' && t.peekByte(3) != '/' {
+				triviaKind = TriviaDocComment
+			}
+			t.fillUntil(t.cursor+2, "*/")
+			end := strings.Index(t.src[t.cursor+2:], "*/")
+			if end < 0 {
+				t.errorf(t.pos(), "unterminated block comment")
+				// the comment runs to the end of the input
+				end = len(t.src)
+			} else {
+				end += t.cursor + 4
+			}
+			for t.cursor < end {
+				t.next()
+			}
+		case t.base+t.cursor == 0 && strings.HasPrefix(t.src, utf8BOM):
+			// editors on Windows like to put a BOM in front, it is not part of the program
+			t.cursor = len(utf8BOM)
+			triviaKind = TriviaBOM
+		default:
+			return t.triviaSince(first)
+		}
+		if t.KeepTrivia {
+			t.trivia = append(t.trivia, Trivia{
+				Kind: triviaKind,
+				Text: t.src[start:t.cursor],
+				Pos:  token.Position{File: t.filePath, Offset: t.base + start, Line: startLine, Column: startColumn},
+			})
+		}
+		if stopAtNewline && triviaKind == TriviaNewline {
+			break
+		}
+	}
+	return t.triviaSince(first)
+}
+
+// triviaSince returns the trivia collected after index first
+func (t *Tokenizer) triviaSince(first int) []Trivia {
+	if len(t.trivia) == first {
+		return nil
+	}
+	return t.trivia[first:len(t.trivia):len(t.trivia)]
+}
+
+// Advance moves to the next token and returns it
+func (t *Tokenizer) Advance() Token {
+	t.prev = t.curr
+	// before the first token curr is empty
+	if t.OnConsume != nil && t.prev.Text != "" {
+		t.OnConsume(t.prev)
+	}
+	if len(t.ahead) > 0 {
+		t.curr = t.ahead[0]
+		// lookahead is a few tokens at most, shifting is cheaper than reallocating
+		n := copy(t.ahead, t.ahead[1:])
+		t.ahead[n] = Token{}
+		t.ahead = t.ahead[:n]
+	} else {
+		t.lex(&t.curr)
+	}
+	return t.curr
+}
+
+// lex reads the next token from the input into tok, filling it in place saves
+// copying the token around
+func (t *Tokenizer) lex(tok *Token) {
+	// an illegal character starts the token over, in a loop so that a long
+	// run of them cannot grow the stack. The trivia before it is kept
+	var dropped []Trivia
+	for !t.lexOnce(tok) {
+		dropped = append(dropped, tok.Leading...)
+	}
+	if len(dropped) > 0 {
+		tok.Leading = append(dropped, tok.Leading...)
+	}
+}
+
+// lexOnce is lex up to the first illegal character, it returns false when it
+// dropped one and tok has to be read again
+func (t *Tokenizer) lexOnce(tok *Token) bool {
+	*tok = Token{Kind: TokenTypeEOF, Leading: t.scanTrivia(false), Pos: t.pos()}
+	if t.cursor >= len(t.src) {
+		return true
+	}
+
+	start := t.cursor
+	curByte := t.src[start]
+	switch {
+	case curByte == '"':
+		t.scanString()
+		tok.Kind = TokenTypeStringConst
+		tok.Text = t.src[start:t.cursor]
+		tok.StrVal = strings.TrimSuffix(tok.Text[1:], "\"") // an unterminated one has no closing quote
+	case symbolsSet[curByte]:
+		t.skip(1)
+		tok.Kind = TokenTypeSymbol
+		tok.Text = t.src[start:t.cursor]
+		tok.Symbol = token.SymbolChar(curByte)
+	case isDigit(curByte):
+		tok.IntVal = t.scanInteger()
+		tok.Kind = TokenTypeIntConst
+		tok.Text = t.src[start:t.cursor]
+	case isIdentifierStart(curByte):
+		end := t.cursor + 1
+		for end < len(t.src) && isIdentifierPart(t.src[end]) {
+			end++
+		}
+		t.skip(end - t.cursor)
+		tok.Text = t.src[start:t.cursor]
+		if k := token.Lookup(tok.Text); k != token.KeywordNone {
+			tok.Kind = TokenTypeKeyword
+			tok.Keyword = k
+			tok.Text = k.String() // interned, the same string for every occurrence
+		} else {
+			tok.Kind = TokenTypeIdentifier
+		}
+	default:
+		r, size := utf8.DecodeRuneInString(t.src[t.cursor:])
+		t.errorf(tok.Pos, "illegal character %q", r)
+		// drop it and read the token after it
+		t.skip(size)
+		return false
+	}
+	tok.Trailing = t.scanTrivia(true)
+	return true
+}
+
+// scanString reads a string constant including both quotes. Jack strings
+// cannot contain a newline
+func (t *Tokenizer) scanString() {
+	start := t.pos()
+	end := t.cursor + 1
+	for {
+		if end >= len(t.src) {
+			t.errorf(start, "unterminated string constant")
+			t.skip(end - t.cursor)
+			return
+		}
+		switch t.src[end] {
+		case '"':
+			t.skip(end + 1 - t.cursor)
+			return
+		case '\n', '\r':
+			t.skip(end - t.cursor)
+			t.errorf(t.pos(), "newline in string constant")
+			return
+		}
+		end++
+	}
+}
+
+// scanInteger reads an integer constant, which has to be in 0..32767
+func (t *Tokenizer) scanInteger() int {
+	start := t.pos()
+	num := 0
+	for isDigit(t.peekByte(0)) {
+		if num <= maxIntConst {
+			num = num*10 + int(t.src[t.cursor]-'0')
+		}
+		t.skip(1)
+	}
+	if isIdentifierPart(t.peekByte(0)) {
+		for isIdentifierPart(t.peekByte(0)) {
+			t.skip(1)
+		}
+		t.errorf(start, "malformed identifier %q: identifiers cannot start with a digit", t.src[start.Offset-t.base:t.cursor])
+	}
+	if num > maxIntConst {
+		t.errorf(start, "integer constant %s is out of range 0..%d", t.src[start.Offset-t.base:t.cursor], maxIntConst)
+	}
+	return num
+}
+
+// isWhitespace reports whitespace other than line breaks
+func isWhitespace(b byte) bool {
+	switch b {
+	case ' ', '\t', '\f', '\v':
+		return true
+	}
+	return false
+}
+
+// Current returns the current token
+func (t *Tokenizer) Current() Token {
+	return t.curr
+}
+
+// Previous returns the token before the current one
+func (t *Tokenizer) Previous() Token {
+	return t.prev
+}
+
+func (t *Tokenizer) advanceN(n int) {
+	for i := 0; i < n; i++ {
+		t.Advance()
+	}
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isIdentifierStart(b byte) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+func isIdentifierPart(b byte) bool {
+	return isIdentifierStart(b) || isDigit(b)
+}
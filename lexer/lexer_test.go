@@ -0,0 +1,370 @@
+package lexer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"compiler/token"
+)
+
+func tokenize(t *testing.T, src string) ([]string, []token.Position) {
+	t.Helper()
+	tokenizer := New(strings.NewReader(src), "Main.jack")
+	tokens := make([]string, 0)
+	positions := make([]token.Position, 0)
+	for {
+		tok := tokenizer.Advance()
+		if tok.Kind == TokenTypeEOF {
+			return tokens, positions
+		}
+		tokens = append(tokens, tok.Text)
+		positions = append(positions, tok.Pos)
+	}
+}
+
+func TestTokenizerWhitespace(t *testing.T) {
+	want := []string{"class", "Main", "{", "field", "int", "x", ";", "}"}
+	sources := map[string]string{
+		"spaces":       "class Main {\n    field int x;\n}\n",
+		"tabs":         "class\tMain\t{\n\tfield\tint\tx;\n}\n",
+		"crlf":         "class Main {\r\n\tfield int x;\r\n}\r\n",
+		"cr":           "class Main {\r\tfield int x;\r}\r",
+		"form feed":    "class Main {\f\n  field int x;\v\n}\f",
+		"bom":          utf8BOM + "class Main {\n  field int x;\n}",
+		"mixed":        utf8BOM + "class \t Main{\r\n \t\f field  int\tx ;  \r\n\r\n}",
+		"no newline":   "class Main { field int x; }",
+		"crlf comment": "// header\r\nclass Main { /* a\r\n b */\r\n\tfield int x; // x\r\n}\r\n",
+	}
+	for name, src := range sources {
+		t.Run(name, func(t *testing.T) {
+			got, _ := tokenize(t, src)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// positions count the comments and the indentation before a token
+func TestTokenizerPositions(t *testing.T) {
+	src := "/** Main. */\nclass Main {\n    // x\n    field /* a */ int x;\n}"
+	path := "Main.jack"
+	tokenizer := New(strings.NewReader(src), path)
+	want := [][2]int{{2, 1}, {2, 7}, {2, 12}, {4, 5}, {4, 19}, {4, 23}, {4, 24}, {5, 1}}
+	for i, w := range want {
+		tok := tokenizer.Advance()
+		if tok.Pos.File != path || tok.Pos.Line != w[0] || tok.Pos.Column != w[1] {
+			t.Errorf("token %d %q at %s, want %s:%d:%d", i, tok.Text, tok.Pos, path, w[0], w[1])
+		}
+	}
+}
+
+func TestTokenizerComments(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"slashes in a string", `do f("http://x"); // y`, []string{"do", "f", "(", `"http://x"`, ")", ";"}},
+		{"block comment after code", "let x = 1; /* a */ let y = /** b */ 2;", []string{"let", "x", "=", "1", ";", "let", "y", "=", "2", ";"}},
+		{"block comment lines without stars", "let x = 1; /*\n  let y = 2;\nreturn x;\n */ return;", []string{"let", "x", "=", "1", ";", "return", ";"}},
+		{"comment markers in a string", `do f("/* a */", "*/");`, []string{"do", "f", "(", `"/* a */"`, ",", `"*/"`, ")", ";"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got, _ := tokenize(t, c.src); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestTokenizerPositionsWithCRLFAndBOM(t *testing.T) {
+	src := utf8BOM + "class Main {\r\n\tfield int x;\r\n}\r\n"
+	_, positions := tokenize(t, src)
+	want := [][2]int{{1, 1}, {1, 7}, {1, 12}, {2, 2}, {2, 8}, {2, 12}, {2, 13}, {3, 1}}
+	if len(positions) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(positions), len(want))
+	}
+	for i, p := range positions {
+		if p.Line != want[i][0] || p.Column != want[i][1] {
+			t.Errorf("token %d at %d:%d, want %d:%d", i, p.Line, p.Column, want[i][0], want[i][1])
+		}
+	}
+}
+
+func TestTokenizerLexicalErrors(t *testing.T) {
+	cases := []struct {
+		src  string
+		line int
+		col  int
+		msg  string
+	}{
+		{"let x = @;", 1, 9, "illegal character '@'"},
+		{"let x = y # 2;", 1, 11, "illegal character '#'"},
+		{"let x = \"é\";\nlet y = ü;", 2, 9, "illegal character 'ü'"},
+		{"let x = 1abc;", 1, 9, `malformed identifier "1abc": identifiers cannot start with a digit`},
+		{"do f(\"abc", 1, 6, "unterminated string constant"},
+		{"do f(\"abc\n\");", 1, 10, "newline in string constant"},
+		{"let x = 32768;", 1, 9, "integer constant 32768 is out of range 0..32767"},
+		{"let x = 99999999999999999999;", 1, 9, "integer constant 99999999999999999999 is out of range 0..32767"},
+		{"class Main {\n  /* never closed\n}", 2, 3, "unterminated block comment"},
+	}
+	for _, c := range cases {
+		t.Run(c.src, func(t *testing.T) {
+			defer func() {
+				d, ok := recover().(token.Diagnostic)
+				if !ok {
+					t.Fatalf("expected a diagnostic")
+				}
+				if d.Pos.Line != c.line || d.Pos.Column != c.col || d.Msg != c.msg {
+					t.Errorf("got %d:%d %q, want %d:%d %q", d.Pos.Line, d.Pos.Column, d.Msg, c.line, c.col, c.msg)
+				}
+			}()
+			tokenize(t, c.src)
+		})
+	}
+}
+
+func TestTokenizerIntegerLimits(t *testing.T) {
+	tokens, _ := tokenize(t, "0 32767 007")
+	if !reflect.DeepEqual(tokens, []string{"0", "32767", "007"}) {
+		t.Errorf("got %q", tokens)
+	}
+}
+
+func TestTokenizerTokenValues(t *testing.T) {
+	tokenizer := New(strings.NewReader(`let s = "a b"; do x.f(007, ~true);`), "Main.jack")
+	want := []Token{
+		{Kind: TokenTypeKeyword, Text: "let", Keyword: token.KeywordLet},
+		{Kind: TokenTypeIdentifier, Text: "s"},
+		{Kind: TokenTypeSymbol, Text: "=", Symbol: token.SymbolEq},
+		{Kind: TokenTypeStringConst, Text: `"a b"`, StrVal: "a b"},
+		{Kind: TokenTypeSymbol, Text: ";", Symbol: token.SymbolSemicolon},
+		{Kind: TokenTypeKeyword, Text: "do", Keyword: token.KeywordDo},
+		{Kind: TokenTypeIdentifier, Text: "x"},
+		{Kind: TokenTypeSymbol, Text: ".", Symbol: token.SymbolDot},
+		{Kind: TokenTypeIdentifier, Text: "f"},
+		{Kind: TokenTypeSymbol, Text: "(", Symbol: token.SymbolLParen},
+		{Kind: TokenTypeIntConst, Text: "007", IntVal: 7},
+		{Kind: TokenTypeSymbol, Text: ",", Symbol: token.SymbolComma},
+		{Kind: TokenTypeSymbol, Text: "~", Symbol: token.SymbolTilde},
+		{Kind: TokenTypeKeyword, Text: "true", Keyword: token.KeywordTrue},
+		{Kind: TokenTypeSymbol, Text: ")", Symbol: token.SymbolRParen},
+		{Kind: TokenTypeSymbol, Text: ";", Symbol: token.SymbolSemicolon},
+		{Kind: TokenTypeEOF},
+	}
+	for i, w := range want {
+		got := tokenizer.Advance()
+		got.Pos = token.Position{}
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("token %d: got %+v, want %+v", i, got, w)
+		}
+	}
+	if s := (Token{Kind: TokenTypeKeyword, Text: "while", Keyword: token.KeywordWhile}).String(); s != "keyword while" {
+		t.Errorf("String() = %q", s)
+	}
+	if token.KeywordConstructor.String() != "constructor" || token.SymbolLt.String() != "<" {
+		t.Errorf("enum names %s %s", token.KeywordConstructor, token.SymbolLt)
+	}
+}
+
+func TestTokenizerPeek(t *testing.T) {
+	tokenizer := New(strings.NewReader("let a[i] = 1;"), "<memory>")
+	if got := tokenizer.Peek(3).Text; got != "[" {
+		t.Fatalf("peek(3) = %q, want [", got)
+	}
+	tokenizer.Advance()
+	if !tokenizer.Current().IsKeyword(token.KeywordLet) || tokenizer.Peek(1).Text != "a" || tokenizer.Peek(2).Text != "[" {
+		t.Fatalf("peek consumed tokens: cur %s", tokenizer.Current())
+	}
+	tokenizer.advanceN(2)
+	if !tokenizer.Current().IsSymbol(token.SymbolLBracket) || tokenizer.Current().Pos.Column != 6 {
+		t.Fatalf("cur %s at %s", tokenizer.Current(), tokenizer.Current().Pos)
+	}
+	if got := tokenizer.Peek(maxLookahead); got.Kind != TokenTypeEOF {
+		t.Fatalf("peek past the end = %s, want end of file", got)
+	}
+	tokenizer.advanceN(5)
+	if !tokenizer.Current().IsSymbol(token.SymbolSemicolon) || !tokenizer.hasMoreTokens() {
+		t.Fatalf("cur %s", tokenizer.Current())
+	}
+	tokenizer.Advance()
+	if tokenizer.hasMoreTokens() {
+		t.Fatalf("expected the end of the input")
+	}
+}
+
+func TestTokenizerPeekIsBounded(t *testing.T) {
+	for _, n := range []int{0, -1, maxLookahead + 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("peek(%d) did not panic", n)
+				}
+			}()
+			New(strings.NewReader("let a = 1;"), "<memory>").Peek(n)
+		}()
+	}
+}
+
+func TestTokenizerTrivia(t *testing.T) {
+	src := utf8BOM + "/** Doc. */\r\nclass Main { // the class\n\n\t/* a */ field int x; /* b */\n}\n// end"
+	tokenizer := New(strings.NewReader(src), "Main.jack")
+	tokenizer.KeepTrivia = true
+
+	var rebuilt strings.Builder
+	var tokens []Token
+	for {
+		tok := tokenizer.Advance()
+		tokens = append(tokens, tok)
+		rebuilt.WriteString(tok.SourceText())
+		if tok.Kind == TokenTypeEOF {
+			break
+		}
+	}
+	if rebuilt.String() != src {
+		t.Fatalf("rebuilt source\n%q\nwant\n%q", rebuilt.String(), src)
+	}
+
+	kinds := func(trivia []Trivia) []TriviaKind {
+		out := make([]TriviaKind, 0)
+		for _, tr := range trivia {
+			out = append(out, tr.Kind)
+		}
+		return out
+	}
+	class, brace, field, semicolon, eof := tokens[0], tokens[2], tokens[3], tokens[6], tokens[len(tokens)-1]
+	if got := kinds(class.Leading); !reflect.DeepEqual(got, []TriviaKind{TriviaBOM, TriviaDocComment, TriviaNewline}) {
+		t.Errorf("class leading trivia %v", got)
+	}
+	if class.Pos.Line != 2 || class.Pos.Column != 1 || class.Leading[1].Pos.Column != 1 {
+		t.Errorf("class at %s, doc comment at %s", class.Pos, class.Leading[1].Pos)
+	}
+	if got := kinds(brace.Trailing); !reflect.DeepEqual(got, []TriviaKind{TriviaWhitespace, TriviaLineComment, TriviaNewline}) {
+		t.Errorf("{ trailing trivia %v", got)
+	}
+	if got := kinds(field.Leading); !reflect.DeepEqual(got, []TriviaKind{TriviaNewline, TriviaWhitespace, TriviaBlockComment, TriviaWhitespace}) {
+		t.Errorf("field leading trivia %v", got)
+	}
+	if semicolon.Trailing[1].Text != "/* b */" {
+		t.Errorf("; trailing trivia %q", semicolon.Trailing)
+	}
+	if got := kinds(eof.Leading); !reflect.DeepEqual(got, []TriviaKind{TriviaLineComment}) {
+		t.Errorf("EOF leading trivia %v", got)
+	}
+}
+
+func TestTokenizerDropsTriviaByDefault(t *testing.T) {
+	tok := New(strings.NewReader("/* a */ class // b\n"), "Main.jack").Advance()
+	if tok.Leading != nil || tok.Trailing != nil {
+		t.Errorf("unexpected trivia %q %q", tok.Leading, tok.Trailing)
+	}
+}
+
+// benchmarkSource generates a Jack class of roughly the given number of lines
+func benchmarkSource(lines int) []byte {
+	var b strings.Builder
+	b.WriteString("/** Generated for benchmarks. */\nclass Bench {\n    field int x, y;\n    static Array cache;\n\n")
+	for i := 0; b.Len() < lines*32; i++ {
+		fmt.Fprintf(&b, "    /** Method number %d. */\n", i)
+		fmt.Fprintf(&b, "    method int step%d(int a, char c, boolean flag) {\n", i)
+		b.WriteString("        var int i, sum;\n        var String s;\n")
+		b.WriteString("        let s = \"HOW MANY NUMBERS? \"; // a prompt\n")
+		b.WriteString("        while ((i < 32767) & ~flag) {\n")
+		b.WriteString("            let sum = sum + (cache[i] * (a - 2)) / 3;\n")
+		b.WriteString("            if (sum > x) { do Output.printInt(sum); } else { let y = -y; }\n")
+		b.WriteString("            let i = i + 1;\n        }\n")
+		b.WriteString("        return sum;\n    }\n\n")
+	}
+	b.WriteString("}\n")
+	return []byte(b.String())
+}
+
+// a streamed input is lexed exactly like the same input read at once, even
+// when the reader hands it over one byte at a time
+func TestTokenizerStreamsLikeWholeInput(t *testing.T) {
+	srcs := []string{
+		relexSource,
+		utf8BOM + "class A {\r\n}\r",
+		"class /* a\r\nb */ A { /** x */ }",
+		"let s = \"abc\ndef\";",
+		"x /*/ y */ 99999 9a @ z",
+		"/* never closed\n",
+		"// no line break at the end",
+	}
+	sources, _ := filepath.Glob(filepath.Join("..", "testdata", "*", "*.jack"))
+	for _, source := range sources {
+		src, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs = append(srcs, string(src))
+	}
+	for _, src := range srcs {
+		_, want, wantErrs := lexWithErrors(src, true)
+		streamed := New(iotest.OneByteReader(strings.NewReader(src)), "Main.jack")
+		streamed.KeepTrivia = true
+		var errs []token.Diagnostic
+		streamed.OnError = func(d token.Diagnostic) {
+			errs = append(errs, d)
+		}
+		if got := streamed.Tokens(); !reflect.DeepEqual(got, want) || !reflect.DeepEqual(errs, wantErrs) {
+			t.Errorf("%.20q: streamed tokens or errors differ\n%v %v\nwant\n%v %v", src, got, errs, want, wantErrs)
+		}
+	}
+}
+
+// the tokens of a pipe come as soon as their line is written, not at the end
+// of the input
+func TestTokenizerStreamsPipes(t *testing.T) {
+	r, w := io.Pipe()
+	timeout := time.AfterFunc(10*time.Second, func() {
+		_ = w.CloseWithError(errors.New("the tokenizer waited for more input"))
+	})
+	defer timeout.Stop()
+	tokenizer := New(r, "<stdin>")
+	go func() { _, _ = io.WriteString(w, "class Main {\n") }()
+	for _, want := range []string{"class", "Main", "{"} {
+		if tok := tokenizer.Advance(); tok.Text != want {
+			t.Fatalf("got %s, want %s", tok, want)
+		}
+	}
+	go func() {
+		_, _ = io.WriteString(w, "}\n")
+		_ = w.Close()
+	}()
+	if tok := tokenizer.Advance(); tok.Text != "}" || tokenizer.Advance().Kind != TokenTypeEOF {
+		t.Errorf("got %s, then not the end of the input", tok)
+	}
+}
+
+func benchmarkTokenizer(b *testing.B, keepTrivia bool) {
+	src := benchmarkSource(100000)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tokenizer := New(bytes.NewReader(src), "Bench.jack")
+		tokenizer.KeepTrivia = keepTrivia
+		for tokenizer.Advance().Kind != TokenTypeEOF {
+		}
+	}
+}
+
+func BenchmarkTokenizer(b *testing.B) {
+	benchmarkTokenizer(b, false)
+}
+
+func BenchmarkTokenizerWithTrivia(b *testing.B) {
+	benchmarkTokenizer(b, true)
+}
@@ -0,0 +1,202 @@
+package lexer
+
+import (
+	"fmt"
+
+	"compiler/token"
+)
+
+/*
+Incremental re-lexing, for editors that change a few characters at a time
+*/
+
+// TextEdit replaces the bytes Start..End (exclusive) of the source with Text
+type TextEdit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// TokenRange is the tokens Start..End (exclusive) of a token list
+type TokenRange struct {
+	Start int
+	End   int
+}
+
+// tokens reads the rest of the input, the last token is always TokenTypeEOF
+func (t *Tokenizer) Tokens() []Token {
+	tokens := make([]Token, 0)
+	for {
+		tok := t.Advance()
+		tokens = append(tokens, tok)
+		if tok.Kind == TokenTypeEOF {
+			return tokens
+		}
+	}
+}
+
+// fullStart is the offset where the token starts, including its leading trivia
+func (tok Token) fullStart() token.Position {
+	if len(tok.Leading) > 0 {
+		return tok.Leading[0].Pos
+	}
+	return tok.Pos
+}
+
+// fullEnd is the offset after the token and its trailing trivia
+func (tok Token) fullEnd() int {
+	if n := len(tok.Trailing); n > 0 {
+		return tok.Trailing[n-1].Pos.Offset + len(tok.Trailing[n-1].Text)
+	}
+	return tok.Pos.Offset + len(tok.Text)
+}
+
+// Relex applies edit to the source of t and updates prev, the tokens t read
+// from the source before the edit. Only the tokens around the edit are lexed
+// again, the ones after it are reused with their positions shifted. It
+// returns the new token list, which of its tokens are new and the lexical
+// errors in the new tokens: an edit that is still being typed, such as an
+// opening " or /*, is lexed like a full lex with OnError set would lex it.
+//
+// Lexing always restarts at the beginning of a token, where the lexer has no
+// state, and stops as soon as a new token starts at the same place as an old
+// one behind the edit: from there on both lexes see the same bytes. t must
+// hold the whole source, it cannot be a streamed one.
+func (t *Tokenizer) Relex(prev []Token, edit TextEdit) ([]Token, TokenRange, []token.Diagnostic) {
+	if t.r != nil || t.base > 0 {
+		panic("relex needs the whole source, the tokenizer streams its input")
+	}
+	if edit.Start < 0 || edit.Start > edit.End || edit.End > len(t.src) {
+		panic(fmt.Sprintf("edit %d..%d out of range 0..%d", edit.Start, edit.End, len(t.src)))
+	}
+	src := t.src[:edit.Start] + edit.Text + t.src[edit.End:]
+	delta := len(edit.Text) - (edit.End - edit.Start)
+
+	// the first token that can see the edit, its trailing trivia or the byte
+	// right after it could be part of the edit
+	first := 0
+	for first < len(prev)-1 && prev[first].fullEnd() < edit.Start {
+		first++
+	}
+	// restart at the token before it, which has a known position
+	restart := Token{Pos: token.Position{File: t.filePath, Line: 1, Column: 1}}
+	fromToken := first > 0
+	if fromToken {
+		first--
+		restart = prev[first]
+	}
+
+	l := &Tokenizer{
+		src:        src,
+		cursor:     restart.Pos.Offset,
+		line:       restart.Pos.Line,
+		column:     restart.Pos.Column,
+		filePath:   t.filePath,
+		KeepTrivia: t.KeepTrivia,
+	}
+	var errs []token.Diagnostic
+	l.OnError = func(d token.Diagnostic) {
+		errs = append(errs, d)
+	}
+	relexed := make([]Token, 0)
+	old := first
+	for {
+		tok := l.Advance()
+		if len(relexed) == 0 && fromToken {
+			// the restart token keeps the leading trivia it was lexed with
+			tok.Leading = restart.Leading
+		}
+		if start := tok.fullStart(); start.Offset >= edit.Start+len(edit.Text) {
+			for old < len(prev) && prev[old].fullStart().Offset+delta < start.Offset {
+				old++
+			}
+			if old < len(prev) && prev[old].fullStart().Offset+delta == start.Offset {
+				oldStart := prev[old].fullStart()
+				tokens := make([]Token, 0, first+len(relexed)+len(prev)-old)
+				tokens = append(tokens, prev[:first]...)
+				tokens = append(tokens, relexed...)
+				for _, reused := range prev[old:] {
+					tokens = append(tokens, shiftToken(reused, delta, start.Line-oldStart.Line,
+						start.Column-oldStart.Column, oldStart.Line))
+				}
+				changed := trimUnchanged(prev, tokens, TokenRange{Start: first, End: first + len(relexed)})
+				t.reset(src, tokens[len(tokens)-1])
+				return tokens, changed, errs
+			}
+		}
+		relexed = append(relexed, tok)
+		if tok.Kind == TokenTypeEOF {
+			break
+		}
+	}
+
+	tokens := append(prev[:first:first], relexed...)
+	changed := trimUnchanged(prev, tokens, TokenRange{Start: first, End: len(tokens)})
+	t.reset(src, tokens[len(tokens)-1])
+	return tokens, changed, errs
+}
+
+// reset puts t at the end of a new source
+func (t *Tokenizer) reset(src string, eof Token) {
+	t.src = src
+	t.cursor = len(src)
+	t.line = eof.Pos.Line
+	t.column = eof.Pos.Column
+	t.ahead = t.ahead[:0]
+	t.curr = eof
+}
+
+// trimUnchanged drops the relexed tokens at the start of changed that are the
+// same as before the edit
+func trimUnchanged(prev []Token, tokens []Token, changed TokenRange) TokenRange {
+	for changed.Start < changed.End && changed.Start < len(prev) && sameToken(prev[changed.Start], tokens[changed.Start]) {
+		changed.Start++
+	}
+	return changed
+}
+
+func sameToken(a Token, b Token) bool {
+	if a.Kind != b.Kind || a.Text != b.Text || a.Pos != b.Pos ||
+		len(a.Leading) != len(b.Leading) || len(a.Trailing) != len(b.Trailing) {
+		return false
+	}
+	for i := range a.Leading {
+		if a.Leading[i] != b.Leading[i] {
+			return false
+		}
+	}
+	for i := range a.Trailing {
+		if a.Trailing[i] != b.Trailing[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// shiftToken moves a token that was behind an edit to its new position.
+// Only what is on the line the edit ended on moves sideways
+func shiftToken(tok Token, delta int, lineDelta int, columnDelta int, onLine int) Token {
+	shift := func(p token.Position) token.Position {
+		if p.Line == onLine {
+			p.Column += columnDelta
+		}
+		p.Line += lineDelta
+		p.Offset += delta
+		return p
+	}
+	shiftTrivia := func(trivia []Trivia) []Trivia {
+		if trivia == nil {
+			return nil
+		}
+		shifted := make([]Trivia, len(trivia))
+		for i, tr := range trivia {
+			tr.Pos = shift(tr.Pos)
+			shifted[i] = tr
+		}
+		return shifted
+	}
+	tok.Pos = shift(tok.Pos)
+	tok.Leading = shiftTrivia(tok.Leading)
+	tok.Trailing = shiftTrivia(tok.Trailing)
+	return tok
+}
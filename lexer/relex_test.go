@@ -0,0 +1,135 @@
+package lexer
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"compiler/token"
+)
+
+const relexSource = `/** A class to edit. */
+class Main {
+    field int x, y; // position
+
+    method void draw() {
+        /* block
+           comment */
+        do Screen.drawRectangle(x, y, x + 10, y + 10);
+        let x = x + "ab".length();
+        return;
+    }
+}
+`
+
+func lexAll(src string, keepTrivia bool) (*Tokenizer, []Token) {
+	tokenizer, tokens, _ := lexWithErrors(src, keepTrivia)
+	return tokenizer, tokens
+}
+
+func lexWithErrors(src string, keepTrivia bool) (*Tokenizer, []Token, []token.Diagnostic) {
+	tokenizer := New(strings.NewReader(src), "Main.jack")
+	tokenizer.KeepTrivia = keepTrivia
+	var errs []token.Diagnostic
+	tokenizer.OnError = func(d token.Diagnostic) {
+		errs = append(errs, d)
+	}
+	return tokenizer, tokenizer.Tokens(), errs
+}
+
+func TestRelexSmallEdit(t *testing.T) {
+	tokenizer, tokens := lexAll(relexSource, false)
+	at := strings.Index(relexSource, "x + 10")
+	got, changed, errs := tokenizer.Relex(tokens, TextEdit{Start: at, End: at + 1, Text: "width"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	_, want := lexAll(tokenizer.src, false)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("relexed tokens differ from a full lex")
+	}
+	if changed.End-changed.Start != 1 || got[changed.Start].Text != "width" {
+		t.Errorf("changed %v: %q", changed, got[changed.Start:changed.End])
+	}
+	if len(got) != len(tokens) {
+		t.Errorf("got %d tokens, want %d", len(got), len(tokens))
+	}
+}
+
+func TestRelexCommentEdit(t *testing.T) {
+	tokenizer, tokens := lexAll(relexSource, true)
+	// turn the block comment into a line comment, its second line becomes code
+	at := strings.Index(relexSource, "/* block")
+	got, changed, _ := tokenizer.Relex(tokens, TextEdit{Start: at, End: at + 2, Text: "//"})
+	_, want := lexAll(tokenizer.src, true)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("relexed tokens differ from a full lex")
+	}
+	texts := make([]string, 0)
+	for _, tok := range got[changed.Start:changed.End] {
+		texts = append(texts, tok.Text)
+	}
+	if !reflect.DeepEqual(texts, []string{"comment", "*", "/", "do"}) {
+		t.Errorf("changed %v: %q", changed, texts)
+	}
+}
+
+func TestRelexRandomEdits(t *testing.T) {
+	inserts := []string{"", " ", "\n", "x", "1", ";", "(", "/", "*", "//", "/*", "*/", "\r\n", "\t", "let"}
+	for _, keepTrivia := range []bool{false, true} {
+		rnd := rand.New(rand.NewSource(1))
+		tokenizer, tokens := lexAll(relexSource, keepTrivia)
+		for i := 0; i < 2000; i++ {
+			start := rnd.Intn(len(tokenizer.src) + 1)
+			end := start + rnd.Intn(3)
+			if end > len(tokenizer.src) {
+				end = len(tokenizer.src)
+			}
+			edit := TextEdit{Start: start, End: end, Text: inserts[rnd.Intn(len(inserts))]}
+			src := tokenizer.src[:start] + edit.Text + tokenizer.src[end:]
+
+			_, want, wantErrs := lexWithErrors(src, keepTrivia)
+			got, changed, errs := tokenizer.Relex(tokens, edit)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("keepTrivia %v, edit %d %+v: relexed tokens differ from a full lex of\n%s", keepTrivia, i, edit, src)
+			}
+			// the errors of the new tokens are errors of the full lex too
+			for _, err := range errs {
+				if !containsDiagnostic(wantErrs, err) {
+					t.Fatalf("edit %d %+v: %s is not an error of the full lex %v", i, edit, err, wantErrs)
+				}
+			}
+			if changed.Start < 0 || changed.Start > changed.End || changed.End > len(got) {
+				t.Fatalf("edit %+v: bad range %v", edit, changed)
+			}
+			tokens = got
+		}
+	}
+}
+
+func containsDiagnostic(diagnostics []token.Diagnostic, d token.Diagnostic) bool {
+	for _, other := range diagnostics {
+		if other == d {
+			return true
+		}
+	}
+	return false
+}
+
+// typing an opening " or /* leaves the source broken until it is closed
+func TestRelexHalfTypedEdits(t *testing.T) {
+	at := strings.Index(relexSource, "return;")
+	for _, text := range []string{`"`, "/*", "@"} {
+		tokenizer, tokens := lexAll(relexSource, false)
+		got, _, errs := tokenizer.Relex(tokens, TextEdit{Start: at, End: at, Text: text})
+		_, want, wantErrs := lexWithErrors(tokenizer.src, false)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: relexed tokens differ from a full lex", text)
+		}
+		if len(errs) != 1 || !reflect.DeepEqual(errs, wantErrs) {
+			t.Errorf("%q: got errors %v, want %v", text, errs, wantErrs)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"strings"
+
+	"compiler/ast"
+	"compiler/lexer"
+)
+
+/*
+Concrete syntax tree, every token of a class with its comments and whitespace
+grouped by the grammar rules that read it, for refactoring and formatting tools
+that have to write the source back
+*/
+
+// CSTNode is a grammar rule with the tokens and rules it was read from, in
+// source order. Rule is named like the compileXxx method that read it
+type CSTNode struct {
+	Rule     string
+	Children []CSTChild
+}
+
+// CSTChild is a token or a rule, exactly one of the two is set
+type CSTChild struct {
+	Token *lexer.Token
+	Node  *CSTNode
+}
+
+// CompileCST parses a class like CompileClass and also builds its concrete
+// syntax tree, from the same grammar rules. The tokens that come after the
+// class, up to and including the end of file with the comments before it,
+// are the last children of the class, so that the tree holds every byte of
+// the source. Only illegal characters are left out, with an error each
+func (e *CompilationEngine) CompileCST() (*ast.Class, *CSTNode) {
+	e.Tokenizer.KeepTrivia = true
+	// the class rule is added to this one when it is left
+	top := &CSTNode{}
+	e.cst = []*CSTNode{top}
+	class := e.CompileClass()
+	root := top.Children[0].Node
+	e.cst = nil
+
+	for {
+		tok := e.Tokenizer.Current()
+		root.Children = append(root.Children, CSTChild{Token: &tok})
+		if tok.Kind == lexer.TokenTypeEOF {
+			return class, root
+		}
+		e.Tokenizer.Advance()
+	}
+}
+
+// String returns the source the node was read from, exactly as it was
+// written when the tree was not changed
+func (n *CSTNode) String() string {
+	var b strings.Builder
+	n.writeSource(&b)
+	return b.String()
+}
+
+func (n *CSTNode) writeSource(b *strings.Builder) {
+	for _, child := range n.Children {
+		if child.Token != nil {
+			b.WriteString(child.Token.SourceText())
+		} else {
+			child.Node.writeSource(b)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"compiler/lexer"
+	"compiler/token"
+)
+
+func parseCST(src string) (*CSTNode, []token.Diagnostic) {
+	engine := New(lexer.New(strings.NewReader(src), "Main.jack"))
+	_, root := engine.CompileCST()
+	return root, engine.Errors
+}
+
+// every sample program prints back byte for byte
+func TestCSTRoundTrip(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("..", "testdata", "*", "*.jack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, source := range sources {
+		src, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, errs := parseCST(string(src))
+		if len(errs) > 0 {
+			t.Errorf("%s: %v", source, errs)
+		}
+		if got := root.String(); got != string(src) {
+			t.Errorf("%s printed back as\n%s", source, got)
+		}
+	}
+}
+
+func TestCSTKeepsEveryByte(t *testing.T) {
+	for _, src := range []string{
+		"\ufeff" + "/** Doc. */\r\nclass Main { // the class\n\n\t/* a */ field int x; /* b */\n}\n// end",
+		"class Main { function void f() { let x = (1 + -y) * a[2]; do g(\"s\", 3); return; } }\n\n",
+		// errors leave the skipped tokens in the tree
+		"class Main { field int x y; function void f() { let = 1; foo bar; return } } } extra",
+		"class Main { function void f() { ",
+		"",
+	} {
+		root, _ := parseCST(src)
+		if got := root.String(); got != src {
+			t.Errorf("printed back as\n%q\nwant\n%q", got, src)
+		}
+	}
+
+	root, errs := parseCST("class Main { /* a */ @ /* b */ # }")
+	if got := root.String(); len(errs) != 2 || got != "class Main { /* a */  /* b */  }" {
+		t.Errorf("got %q with errors %v", got, errs)
+	}
+}
+
+func TestCSTFollowsTheGrammarRules(t *testing.T) {
+	root, errs := parseCST("class Main {\n  field int x; // x\n  method void f() { return x; }\n}\n")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	rules := make([]string, 0)
+	var walk func(n *CSTNode, depth int)
+	walk = func(n *CSTNode, depth int) {
+		rules = append(rules, strings.Repeat(" ", depth)+n.Rule)
+		for _, child := range n.Children {
+			if child.Node != nil {
+				walk(child.Node, depth+1)
+			}
+		}
+	}
+	walk(root, 0)
+	want := []string{"class", " classVarDec", " subroutineDec", "  parameterList", "  subroutineBody",
+		"   statements", "    returnStatement", "     expression", "      term"}
+	if strings.Join(rules, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got rules\n%s\nwant\n%s", strings.Join(rules, "\n"), strings.Join(want, "\n"))
+	}
+
+	dec := root.Children[3].Node
+	if dec.Rule != "classVarDec" || len(dec.Children) != 4 {
+		t.Fatalf("fourth child of the class is %+v", root.Children[3])
+	}
+	semicolon := dec.Children[3].Token
+	if semicolon.Text != ";" || len(semicolon.Trailing) != 3 || semicolon.Trailing[1].Text != "// x" {
+		t.Errorf("; of the field is %+v", semicolon)
+	}
+	// renaming a token changes only that token in the printed source
+	dec.Children[2].Token.Text = "count"
+	if got := root.String(); got != "class Main {\n  field int count; // x\n  method void f() { return x; }\n}\n" {
+		t.Errorf("renamed source is\n%s", got)
+	}
+}
@@ -0,0 +1,653 @@
+// Package parser reads the tokens of a Jack class into its syntax tree, and
+// into a concrete syntax tree that keeps every byte of the source
+package parser
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"compiler/ast"
+	"compiler/lexer"
+	"compiler/token"
+)
+
+// DefaultMaxDepth is the nesting of grammar rules and unary operators a
+// CompilationEngine accepts, far more than any program written by hand but
+// small enough for the stack
+const DefaultMaxDepth = 1000
+
+// CompilationEngine parses the tokens of one class into a syntax tree. A
+// syntax error does not stop it: the error goes to Errors, the parser skips
+// to the next statement or declaration and goes on, so one run finds them all
+type CompilationEngine struct {
+	Tokenizer *lexer.Tokenizer
+	Errors    []token.Diagnostic
+	MaxDepth  int        // how deep rules and unary operators may nest
+	rules     []string   // the grammar rules being parsed, innermost last
+	trace     io.Writer  // when set, rules, tokens and errors are logged to it
+	cst       []*CSTNode // the rules being read when building a concrete syntax tree, innermost last
+}
+
+// bailout unwinds the parser from a syntax error to the nearest rule that can
+// skip the broken input, the error itself is already in Errors
+type bailout struct{}
+
+// New parses the tokens of tokenizer, it takes over its OnError and OnConsume
+func New(tokenizer *lexer.Tokenizer) *CompilationEngine {
+	e := &CompilationEngine{
+		Tokenizer: tokenizer,
+		MaxDepth:  DefaultMaxDepth,
+	}
+	// lexical errors are collected with the syntax errors
+	tokenizer.OnError = e.report
+	tokenizer.OnConsume = e.consume
+	return e
+}
+
+// TraceTo logs every rule entered and left, every token consumed and every
+// error to w, indented by the depth of the rule
+func (e *CompilationEngine) TraceTo(w io.Writer) {
+	e.trace = w
+}
+
+// consume is told about every token the parser moves past
+func (e *CompilationEngine) consume(tok lexer.Token) {
+	e.tracef("%s at %s", tok, tok.Pos)
+	if n := len(e.cst); n > 0 {
+		e.cst[n-1].Children = append(e.cst[n-1].Children, CSTChild{Token: &tok})
+	}
+}
+
+// node starts a node at the current token, finish ends it
+func (e *CompilationEngine) node() ast.Span {
+	return ast.Span{From: e.Tokenizer.Current().Pos}
+}
+
+// finish ends n after the last token consumed
+func (e *CompilationEngine) finish(n *ast.Span) {
+	n.To = e.Tokenizer.Previous().End()
+}
+
+// span is a node from start to the end of the last token consumed
+func (e *CompilationEngine) span(start token.Position) ast.Span {
+	return ast.Span{From: start, To: e.Tokenizer.Previous().End()}
+}
+
+// CompileClass parses the class, the syntax and lexical errors are left in
+// Errors in source order
+func (e *CompilationEngine) CompileClass() *ast.Class {
+	e.Tokenizer.Advance()
+	e.enter("class")
+	defer e.leave()
+	class := &ast.Class{Span: e.node()}
+	e.try(e.syncMember, func() {
+		e.expectKeyword(token.KeywordClass)
+		class.Name = e.compileIdentifier("className")
+		e.expect(token.SymbolLBrace)
+	})
+
+	for {
+		switch cur := e.Tokenizer.Current(); {
+		case cur.IsKeyword(token.KeywordStatic), cur.IsKeyword(token.KeywordField):
+			e.try(e.syncMember, func() {
+				class.VarDecs = append(class.VarDecs, e.compileClassVarDec())
+			})
+		case cur.IsKeyword(token.KeywordMethod), cur.IsKeyword(token.KeywordFunction), cur.IsKeyword(token.KeywordConstructor):
+			e.try(e.syncMember, func() {
+				class.Subroutines = append(class.Subroutines, e.compileSubroutine())
+			})
+		case cur.IsSymbol(token.SymbolRBrace):
+			e.Tokenizer.Advance()
+			if cur := e.Tokenizer.Current(); cur.Kind != lexer.TokenTypeEOF {
+				e.report(token.Diagnostic{Pos: cur.Pos, Msg: fmt.Sprintf("expected end of file after the class, found %s", cur)})
+			}
+			e.finish(&class.Span)
+			e.sortErrors()
+			return class
+		case cur.Kind == lexer.TokenTypeEOF:
+			e.report(e.unexpected("}"))
+			e.finish(&class.Span)
+			e.sortErrors()
+			return class
+		default:
+			e.report(e.unexpected("classVarDec or subroutineDec"))
+			e.syncMember()
+		}
+	}
+}
+
+func (e *CompilationEngine) compileClassVarDec() *ast.ClassVarDec {
+	e.enter("classVarDec")
+	defer e.leave()
+	dec := &ast.ClassVarDec{Span: e.node(), Kind: e.Tokenizer.Current().Keyword}
+	e.expectKeyword(token.KeywordStatic, token.KeywordField)
+	dec.Type = e.compileType()
+	dec.Names = e.compileNames()
+	e.expect(token.SymbolSemicolon)
+	e.finish(&dec.Span)
+	return dec
+}
+
+func (e *CompilationEngine) compileSubroutine() *ast.SubroutineDec {
+	e.enter("subroutineDec")
+	defer e.leave()
+	sub := &ast.SubroutineDec{Span: e.node(), Kind: e.Tokenizer.Current().Keyword}
+	e.expectKeyword(token.KeywordConstructor, token.KeywordFunction, token.KeywordMethod)
+	if e.Tokenizer.Current().IsKeyword(token.KeywordVoid) {
+		cur := e.Tokenizer.Current()
+		e.Tokenizer.Advance()
+		sub.ReturnType = &ast.Type{Span: e.span(cur.Pos), Name: cur.Text}
+	} else {
+		sub.ReturnType = e.compileType()
+	}
+	sub.Name = e.compileIdentifier("subroutineName")
+	e.expect(token.SymbolLParen)
+	sub.Params = e.compileParameterList()
+	e.expect(token.SymbolRParen)
+	sub.Body = e.compileSubroutineBody()
+	e.finish(&sub.Span)
+	return sub
+}
+
+func (e *CompilationEngine) compileParameterList() []*ast.Parameter {
+	e.enter("parameterList")
+	defer e.leave()
+	params := make([]*ast.Parameter, 0)
+	if e.Tokenizer.Current().IsSymbol(token.SymbolRParen) {
+		return params
+	}
+	for {
+		param := &ast.Parameter{Span: e.node()}
+		param.Type = e.compileType()
+		param.Name = e.compileIdentifier("varName")
+		e.finish(&param.Span)
+		params = append(params, param)
+		if !e.Tokenizer.Current().IsSymbol(token.SymbolComma) {
+			return params
+		}
+		e.Tokenizer.Advance()
+	}
+}
+
+func (e *CompilationEngine) compileSubroutineBody() *ast.SubroutineBody {
+	e.enter("subroutineBody")
+	defer e.leave()
+	body := &ast.SubroutineBody{Span: e.node()}
+	e.expect(token.SymbolLBrace)
+	for e.Tokenizer.Current().IsKeyword(token.KeywordVar) {
+		e.try(e.syncStatement, func() { body.VarDecs = append(body.VarDecs, e.compileVarDec()) })
+	}
+	body.Statements = e.compileStatements()
+	e.expect(token.SymbolRBrace)
+	e.finish(&body.Span)
+	return body
+}
+
+func (e *CompilationEngine) compileVarDec() *ast.VarDec {
+	e.enter("varDec")
+	defer e.leave()
+	dec := &ast.VarDec{Span: e.node()}
+	e.expectKeyword(token.KeywordVar)
+	dec.Type = e.compileType()
+	dec.Names = e.compileNames()
+	e.expect(token.SymbolSemicolon)
+	e.finish(&dec.Span)
+	return dec
+}
+
+func (e *CompilationEngine) compileStatements() []ast.Statement {
+	e.enter("statements")
+	defer e.leave()
+	statements := make([]ast.Statement, 0)
+	for {
+		cur := e.Tokenizer.Current()
+		switch cur.Keyword {
+		case token.KeywordLet:
+			e.try(e.syncStatement, func() { statements = append(statements, e.compileLet()) })
+		case token.KeywordDo:
+			e.try(e.syncStatement, func() { statements = append(statements, e.compileDo()) })
+		case token.KeywordIf:
+			e.try(e.syncStatement, func() { statements = append(statements, e.compileIf()) })
+		case token.KeywordReturn:
+			e.try(e.syncStatement, func() { statements = append(statements, e.compileReturn()) })
+		case token.KeywordWhile:
+			e.try(e.syncStatement, func() { statements = append(statements, e.compileWhile()) })
+		default:
+			// "}", or the statements ran into the next declaration
+			if cur.IsSymbol(token.SymbolRBrace) || cur.Kind == lexer.TokenTypeEOF || isMemberKeyword(cur) {
+				return statements
+			}
+			e.report(e.unexpected("a statement"))
+			e.syncStatement()
+		}
+	}
+}
+
+func (e *CompilationEngine) compileLet() *ast.LetStatement {
+	e.enter("letStatement")
+	defer e.leave()
+	let := &ast.LetStatement{Span: e.node()}
+	e.expectKeyword(token.KeywordLet)
+	let.Name = e.compileIdentifier("varName")
+	if e.Tokenizer.Current().IsSymbol(token.SymbolLBracket) {
+		e.Tokenizer.Advance()
+		let.Index = e.compileExpression()
+		e.expect(token.SymbolRBracket)
+	}
+	e.expect(token.SymbolEq)
+	let.Value = e.compileExpression()
+	e.expect(token.SymbolSemicolon)
+	e.finish(&let.Span)
+	return let
+}
+
+func (e *CompilationEngine) compileIf() *ast.IfStatement {
+	e.enter("ifStatement")
+	defer e.leave()
+	stmt := &ast.IfStatement{Span: e.node()}
+	e.expectKeyword(token.KeywordIf)
+	stmt.Condition = e.compileCondition()
+	stmt.Then = e.compileBlock()
+	if e.Tokenizer.Current().IsKeyword(token.KeywordElse) {
+		e.Tokenizer.Advance()
+		stmt.HasElse = true
+		stmt.Else = e.compileBlock()
+	}
+	e.finish(&stmt.Span)
+	return stmt
+}
+
+func (e *CompilationEngine) compileWhile() *ast.WhileStatement {
+	e.enter("whileStatement")
+	defer e.leave()
+	stmt := &ast.WhileStatement{Span: e.node()}
+	e.expectKeyword(token.KeywordWhile)
+	stmt.Condition = e.compileCondition()
+	stmt.Body = e.compileBlock()
+	e.finish(&stmt.Span)
+	return stmt
+}
+
+func (e *CompilationEngine) compileDo() *ast.DoStatement {
+	e.enter("doStatement")
+	defer e.leave()
+	stmt := &ast.DoStatement{Span: e.node()}
+	e.expectKeyword(token.KeywordDo)
+	stmt.Call = e.compileSubroutineCall()
+	e.expect(token.SymbolSemicolon)
+	e.finish(&stmt.Span)
+	return stmt
+}
+
+func (e *CompilationEngine) compileReturn() *ast.ReturnStatement {
+	e.enter("returnStatement")
+	defer e.leave()
+	stmt := &ast.ReturnStatement{Span: e.node()}
+	e.expectKeyword(token.KeywordReturn)
+	if !e.Tokenizer.Current().IsSymbol(token.SymbolSemicolon) {
+		stmt.Value = e.compileExpression()
+	}
+	e.expect(token.SymbolSemicolon)
+	e.finish(&stmt.Span)
+	return stmt
+}
+
+// term (op term)*, nested to the left
+func (e *CompilationEngine) compileExpression() ast.Expression {
+	e.enter("expression")
+	defer e.leave()
+	expr := e.compileTerm()
+	for e.Tokenizer.Current().IsOp() {
+		op := e.Tokenizer.Current().Symbol
+		e.Tokenizer.Advance()
+		right := e.compileTerm()
+		expr = &ast.BinaryExpression{Span: e.span(expr.Pos()), Op: op, Left: expr, Right: right}
+	}
+	return expr
+}
+
+func (e *CompilationEngine) compileTerm() ast.Expression {
+	cur := e.Tokenizer.Current()
+	if !isTermStart(cur) {
+		// named after the rule that needs the term
+		e.expected("a term")
+	}
+	e.enter("term")
+	defer e.leave()
+	switch cur.Kind {
+	case lexer.TokenTypeIntConst:
+		e.Tokenizer.Advance()
+		return &ast.IntegerConstant{Span: e.span(cur.Pos), Value: cur.IntVal}
+	case lexer.TokenTypeStringConst:
+		e.Tokenizer.Advance()
+		return &ast.StringConstant{Span: e.span(cur.Pos), Value: cur.StrVal}
+	case lexer.TokenTypeKeyword:
+		e.Tokenizer.Advance()
+		return &ast.KeywordConstant{Span: e.span(cur.Pos), Value: cur.Keyword}
+	case lexer.TokenTypeIdentifier:
+		switch ahead := e.Tokenizer.Peek(1); {
+		case ahead.IsSymbol(token.SymbolLBracket):
+			access := &ast.ArrayAccess{Span: e.node(), Name: e.compileIdentifier("varName")}
+			e.Tokenizer.Advance() // skip [
+			access.Index = e.compileExpression()
+			e.expect(token.SymbolRBracket)
+			e.finish(&access.Span)
+			return access
+		case ahead.IsSymbol(token.SymbolDot), ahead.IsSymbol(token.SymbolLParen):
+			return e.compileSubroutineCall()
+		default:
+			name := e.compileIdentifier("varName")
+			return &ast.VarRef{Span: name.Span, Name: name}
+		}
+	}
+	if cur.IsSymbol(token.SymbolLParen) {
+		e.Tokenizer.Advance()
+		inner := e.compileExpression()
+		e.expect(token.SymbolRParen)
+		return &ast.ParenExpression{Span: e.span(cur.Pos), Inner: inner}
+	}
+	return e.compileUnary()
+}
+
+// compileUnary reads unaryOp+ term. The operators are read in a loop rather
+// than as a term each, so that a long chain of them cannot grow the stack
+func (e *CompilationEngine) compileUnary() ast.Expression {
+	ops := make([]lexer.Token, 0, 1)
+	for cur := e.Tokenizer.Current(); cur.IsSymbol(token.SymbolMinus) || cur.IsSymbol(token.SymbolTilde); cur = e.Tokenizer.Current() {
+		if len(e.rules)+len(ops) >= e.MaxDepth {
+			e.tooDeep()
+		}
+		ops = append(ops, cur)
+		e.Tokenizer.Advance()
+	}
+	expr := e.compileTerm()
+	for i := len(ops) - 1; i >= 0; i-- {
+		expr = &ast.UnaryExpression{Span: e.span(ops[i].Pos), Op: ops[i].Symbol, Operand: expr}
+	}
+	return expr
+}
+
+func (e *CompilationEngine) compileExpressionList() []ast.Expression {
+	e.enter("expressionList")
+	defer e.leave()
+	exprs := make([]ast.Expression, 0)
+	if e.Tokenizer.Current().IsSymbol(token.SymbolRParen) {
+		return exprs
+	}
+	for {
+		exprs = append(exprs, e.compileExpression())
+		if !e.Tokenizer.Current().IsSymbol(token.SymbolComma) {
+			return exprs
+		}
+		e.Tokenizer.Advance()
+	}
+}
+
+// name(args) or receiver.name(args)
+func (e *CompilationEngine) compileSubroutineCall() *ast.SubroutineCall {
+	e.enter("subroutineCall")
+	defer e.leave()
+	call := &ast.SubroutineCall{Span: e.node()}
+	if e.Tokenizer.Peek(1).IsSymbol(token.SymbolDot) {
+		call.Receiver = e.compileIdentifier("className or varName")
+		e.Tokenizer.Advance() // skip .
+	}
+	call.Name = e.compileIdentifier("subroutineName")
+	e.expect(token.SymbolLParen)
+	call.Args = e.compileExpressionList()
+	e.expect(token.SymbolRParen)
+	e.finish(&call.Span)
+	return call
+}
+
+// ( expression ) of an if or a while
+func (e *CompilationEngine) compileCondition() ast.Expression {
+	e.expect(token.SymbolLParen)
+	cond := e.compileExpression()
+	e.expect(token.SymbolRParen)
+	return cond
+}
+
+// { statements } of an if, an else or a while
+func (e *CompilationEngine) compileBlock() []ast.Statement {
+	e.expect(token.SymbolLBrace)
+	statements := e.compileStatements()
+	e.expect(token.SymbolRBrace)
+	return statements
+}
+
+// varName (, varName)*
+func (e *CompilationEngine) compileNames() []*ast.Identifier {
+	names := []*ast.Identifier{e.compileIdentifier("varName")}
+	for e.Tokenizer.Current().IsSymbol(token.SymbolComma) {
+		e.Tokenizer.Advance()
+		names = append(names, e.compileIdentifier("varName"))
+	}
+	return names
+}
+
+// compileIdentifier reads an identifier, what is its role in the grammar
+func (e *CompilationEngine) compileIdentifier(what string) *ast.Identifier {
+	cur := e.Tokenizer.Current()
+	if cur.Kind != lexer.TokenTypeIdentifier {
+		e.expected(what)
+	}
+	e.Tokenizer.Advance()
+	return &ast.Identifier{Span: e.span(cur.Pos), Name: cur.Text}
+}
+
+// int, char, boolean or a class name. void is only a return type
+func (e *CompilationEngine) compileType() *ast.Type {
+	cur := e.Tokenizer.Current()
+	switch {
+	case cur.Kind == lexer.TokenTypeIdentifier:
+	case cur.IsKeyword(token.KeywordInt), cur.IsKeyword(token.KeywordChar), cur.IsKeyword(token.KeywordBoolean):
+	default:
+		e.expected("type")
+	}
+	e.Tokenizer.Advance()
+	return &ast.Type{Span: e.span(cur.Pos), Name: cur.Text}
+}
+
+// expect consumes the symbol s, anything else is a syntax error
+func (e *CompilationEngine) expect(s token.SymbolChar) {
+	if !e.Tokenizer.Current().IsSymbol(s) {
+		e.expected(s.String())
+	}
+	e.Tokenizer.Advance()
+}
+
+// expectKeyword consumes one of the keywords, anything else is a syntax error
+func (e *CompilationEngine) expectKeyword(keywords ...token.Keyword) {
+	cur := e.Tokenizer.Current()
+	for _, k := range keywords {
+		if cur.IsKeyword(k) {
+			e.Tokenizer.Advance()
+			return
+		}
+	}
+	names := make([]string, len(keywords))
+	for i, k := range keywords {
+		names[i] = k.String()
+	}
+	e.expected(strings.Join(names, " or "))
+}
+
+// enter and leave keep track of the grammar rules being parsed, so that
+// errors can say where in the grammar they are
+func (e *CompilationEngine) enter(rule string) {
+	if len(e.rules) >= e.MaxDepth {
+		e.tooDeep()
+	}
+	if e.trace != nil {
+		cur := e.Tokenizer.Current()
+		e.tracef("%s at %s, %s", rule, cur.Pos, cur)
+	}
+	e.rules = append(e.rules, rule)
+	if e.cst != nil {
+		e.cst = append(e.cst, &CSTNode{Rule: rule})
+	}
+}
+
+func (e *CompilationEngine) leave() {
+	rule := e.rules[len(e.rules)-1]
+	e.rules = e.rules[:len(e.rules)-1]
+	e.tracef("end %s", rule)
+	if n := len(e.cst); n > 1 {
+		e.cst[n-2].Children = append(e.cst[n-2].Children, CSTChild{Node: e.cst[n-1]})
+		e.cst = e.cst[:n-1]
+	}
+}
+
+// tooDeep stops the parse of a statement nested deeper than MaxDepth. The
+// outermost rule is always parsed, there is nothing to skip to around it
+func (e *CompilationEngine) tooDeep() {
+	if len(e.rules) == 0 {
+		return
+	}
+	cur := e.Tokenizer.Current()
+	e.report(token.Diagnostic{Pos: cur.Pos, Msg: fmt.Sprintf("nested more than %d levels deep in %s", e.MaxDepth, e.rules[len(e.rules)-1])})
+	panic(bailout{})
+}
+
+func (e *CompilationEngine) tracef(format string, args ...interface{}) {
+	if e.trace == nil {
+		return
+	}
+	_, _ = fmt.Fprintf(e.trace, "%s%s\n", strings.Repeat("  ", len(e.rules)), fmt.Sprintf(format, args...))
+}
+
+// unexpected is the error for a current token that is not what the rule
+// being parsed needs
+func (e *CompilationEngine) unexpected(what string) token.Diagnostic {
+	cur := e.Tokenizer.Current()
+	return token.Diagnostic{Pos: cur.Pos, Msg: fmt.Sprintf("expected %s in %s, found %s", what, e.rules[len(e.rules)-1], cur)}
+}
+
+// expected records an unexpected token and bails out of the rule
+func (e *CompilationEngine) expected(what string) {
+	e.report(e.unexpected(what))
+	panic(bailout{})
+}
+
+// report records an error. A second error at the same place is almost always
+// caused by the first one and is dropped
+func (e *CompilationEngine) report(d token.Diagnostic) {
+	if n := len(e.Errors); n > 0 && e.Errors[n-1].Pos == d.Pos {
+		return
+	}
+	e.tracef("error %s", d)
+	e.Errors = append(e.Errors, d)
+}
+
+// try runs parse, and when it bails out on a syntax error skips the rest of
+// the broken input with sync. A parse that bailed out before consuming
+// anything skips its first token, else sync would stop at the token parse
+// starts at and the caller would try it again forever
+func (e *CompilationEngine) try(sync func(), parse func()) {
+	start := e.Tokenizer.Current().Pos
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			e.tracef("skipping to the next statement or declaration")
+			if cur := e.Tokenizer.Current(); cur.Pos == start && cur.Kind != lexer.TokenTypeEOF {
+				e.Tokenizer.Advance()
+			}
+			sync()
+		}
+	}()
+	parse()
+}
+
+// syncStatement skips the rest of a broken statement: up to and including the
+// next `;` or `{ }` block (with its else block), or up to the next statement
+// keyword or `}`
+func (e *CompilationEngine) syncStatement() {
+	depth := 0
+	for {
+		cur := e.Tokenizer.Current()
+		switch {
+		case cur.Kind == lexer.TokenTypeEOF, isMemberKeyword(cur):
+			return
+		case cur.IsSymbol(token.SymbolLBrace):
+			depth++
+		case cur.IsSymbol(token.SymbolRBrace):
+			if depth == 0 {
+				return
+			}
+			depth--
+			if depth == 0 {
+				if e.Tokenizer.Advance().IsKeyword(token.KeywordElse) {
+					continue
+				}
+				return
+			}
+		case depth == 0 && cur.IsSymbol(token.SymbolSemicolon):
+			e.Tokenizer.Advance()
+			return
+		case depth == 0 && isStatementKeyword(cur):
+			return
+		}
+		e.Tokenizer.Advance()
+	}
+}
+
+// syncMember skips to the next class variable or subroutine declaration, or
+// to the `}` that closes the class
+func (e *CompilationEngine) syncMember() {
+	for {
+		cur := e.Tokenizer.Current()
+		if cur.Kind == lexer.TokenTypeEOF || isMemberKeyword(cur) ||
+			(cur.IsSymbol(token.SymbolRBrace) && e.Tokenizer.Peek(1).Kind == lexer.TokenTypeEOF) {
+			return
+		}
+		e.Tokenizer.Advance()
+	}
+}
+
+// sortErrors puts the errors in source order, the lexer finds its errors
+// while the parser looks ahead so they can come in early
+func (e *CompilationEngine) sortErrors() {
+	sort.SliceStable(e.Errors, func(i, j int) bool {
+		return e.Errors[i].Pos.Offset < e.Errors[j].Pos.Offset
+	})
+}
+
+// isTermStart reports the tokens a term can start with
+func isTermStart(tok lexer.Token) bool {
+	switch tok.Kind {
+	case lexer.TokenTypeIntConst, lexer.TokenTypeStringConst, lexer.TokenTypeIdentifier:
+		return true
+	case lexer.TokenTypeKeyword:
+		switch tok.Keyword {
+		case token.KeywordTrue, token.KeywordFalse, token.KeywordNull, token.KeywordThis:
+			return true
+		}
+	case lexer.TokenTypeSymbol:
+		return tok.IsSymbol(token.SymbolLParen) || tok.IsSymbol(token.SymbolMinus) || tok.IsSymbol(token.SymbolTilde)
+	}
+	return false
+}
+
+func isStatementKeyword(tok lexer.Token) bool {
+	switch {
+	case tok.IsKeyword(token.KeywordLet), tok.IsKeyword(token.KeywordIf), tok.IsKeyword(token.KeywordWhile),
+		tok.IsKeyword(token.KeywordDo), tok.IsKeyword(token.KeywordReturn):
+		return true
+	}
+	return false
+}
+
+// isMemberKeyword reports the keywords that start a class variable or a subroutine
+func isMemberKeyword(tok lexer.Token) bool {
+	switch {
+	case tok.IsKeyword(token.KeywordStatic), tok.IsKeyword(token.KeywordField), tok.IsKeyword(token.KeywordConstructor),
+		tok.IsKeyword(token.KeywordFunction), tok.IsKeyword(token.KeywordMethod):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"compiler/ast"
+	"compiler/token"
+)
+
+/*
+Resolver checks that every name in a class refers to something declared:
+variables to the symbol tables of the class and of the subroutine, class names
+to the classes of the program and of the OS, subroutines to their class. It
+also checks that every name is declared once
+*/
+
+type Resolver struct {
+	classes     map[string]*ast.Class // the parsed classes of the program and the OS by name
+	classNames  map[string]bool       // every class of the program and the OS, nil when the program is not known
+	errors      []token.Diagnostic
+	classTable  *ast.SymbolTable // the Symbols of class
+	methodTable *ast.SymbolTable // the Symbols of subroutine
+	class       *ast.Class
+	subroutine  *ast.SubroutineDec
+	subroutines map[string]bool // the subroutines of the class declared so far
+}
+
+// buildResolver resolves against the parsed classes and the OS. classNames
+// are all the classes of the program, parsed or not; when it is nil only the
+// OS and the parsed classes are known and other class names are not checked
+func buildResolver(classes []*ast.Class, classNames []string) *Resolver {
+	r := &Resolver{
+		classes: make(map[string]*ast.Class),
+	}
+	for _, class := range getOSClasses() {
+		r.classes[class.Name.Name] = class
+	}
+	for _, class := range classes {
+		r.classes[class.Name.Name] = class
+	}
+	if classNames != nil {
+		r.classNames = make(map[string]bool)
+		for name := range r.classes {
+			r.classNames[name] = true
+		}
+		for _, name := range classNames {
+			r.classNames[name] = true
+		}
+	}
+	return r
+}
+
+// resolveClass leaves the errors of the class in r.errors and sets the
+// Symbols of the class and of its subroutines
+func (r *Resolver) resolveClass(class *ast.Class) {
+	r.errors = nil
+	r.class = class
+	ast.Inspect(class, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Class:
+			r.checkFileName(n)
+			r.classTable = ast.NewSymbolTable(ast.ClassLevel)
+			n.Symbols = r.classTable
+			for _, dec := range n.VarDecs {
+				for _, name := range dec.Names {
+					r.define(r.classTable, name, dec.Type.Name, ast.SymbolKind(dec.Kind.String()), "class "+n.Name.Name)
+				}
+			}
+			r.subroutines = make(map[string]bool)
+		case *ast.SubroutineDec:
+			if r.subroutines[n.Name.Name] {
+				r.errorf(n.Name, "subroutine %s is already declared in class %s", n.Name.Name, r.class.Name.Name)
+			}
+			r.subroutines[n.Name.Name] = true
+			r.subroutine = n
+			r.methodTable = ast.NewSymbolTable(ast.SubroutineLevel)
+			n.Symbols = r.methodTable
+			// the object a method is called on is its argument 0
+			if n.Kind == token.KeywordMethod {
+				r.methodTable.Define("this", r.class.Name.Name, ast.KindArg)
+			}
+			scope := "subroutine " + n.Name.Name
+			for _, param := range n.Params {
+				r.define(r.methodTable, param.Name, param.Type.Name, ast.KindArg, scope)
+			}
+			for _, dec := range n.Body.VarDecs {
+				for _, name := range dec.Names {
+					r.define(r.methodTable, name, dec.Type.Name, ast.KindVar, scope)
+				}
+			}
+		case *ast.Type:
+			if !n.IsBuiltin() && r.classNames != nil && !r.classNames[n.Name] {
+				r.errorf(n, "undeclared class %s", n.Name)
+			}
+		case *ast.LetStatement:
+			r.resolveVar(n.Name)
+		case *ast.VarRef:
+			r.resolveVar(n.Name)
+		case *ast.ArrayAccess:
+			r.resolveVar(n.Name)
+		case *ast.KeywordConstant:
+			if n.Value == token.KeywordThis && r.subroutine.Kind == token.KeywordFunction {
+				r.errorf(n, "this used in function %s", r.subroutine.Name.Name)
+			}
+		case *ast.SubroutineCall:
+			r.resolveCall(n)
+		}
+		return true
+	})
+}
+
+// checkFileName checks that a class read from a .jack file is named after it,
+// as the VM names its subroutines after the class and the file
+func (r *Resolver) checkFileName(class *ast.Class) {
+	file := class.Pos().File
+	if filepath.Ext(file) != ".jack" {
+		return
+	}
+	if want := strings.TrimSuffix(filepath.Base(file), ".jack"); class.Name.Name != want {
+		r.errorf(class.Name, "class %s is declared in %s, it must be named %s", class.Name.Name, filepath.Base(file), want)
+	}
+}
+
+// define declares name in table once, an argument or a local variable of the
+// same name as a field or a static hides it with a warning
+func (r *Resolver) define(table *ast.SymbolTable, name *ast.Identifier, typeName string, kind ast.SymbolKind, scope string) {
+	if !table.Define(name.Name, typeName, kind) {
+		r.errorf(name, "%s is already declared in %s", name.Name, scope)
+		return
+	}
+	if table == r.methodTable && r.classTable.IndexOf(name.Name) >= 0 {
+		r.warnf(name, "%s %s shadows %s %s", kindName(kind), name.Name, kindName(r.classTable.KindOf(name.Name)), name.Name)
+	}
+}
+
+func kindName(k ast.SymbolKind) string {
+	switch k {
+	case ast.KindArg:
+		return "argument"
+	case ast.KindVar:
+		return "local variable"
+	case ast.KindStatic:
+		return "static variable"
+	}
+	return string(k)
+}
+
+func (r *Resolver) resolveVar(name *ast.Identifier) {
+	if !r.isVar(name.Name) {
+		r.errorf(name, "undeclared variable %s", name.Name)
+		return
+	}
+	r.checkField(name)
+}
+
+// checkField checks that a field is used in a method or a constructor, a
+// function has no this to find it in
+func (r *Resolver) checkField(name *ast.Identifier) {
+	if r.methodTable.IndexOf(name.Name) < 0 && r.classTable.KindOf(name.Name) == ast.KindField && r.subroutine.Kind == token.KeywordFunction {
+		r.errorf(name, "field %s used in function %s", name.Name, r.subroutine.Name.Name)
+	}
+}
+
+func (r *Resolver) isVar(name string) bool {
+	return r.methodTable.IndexOf(name) >= 0 || r.classTable.IndexOf(name) >= 0
+}
+
+// resolveCall checks the receiver of a call, and the subroutine when the
+// class it is called on was parsed: a method is called on an object, a
+// function or a constructor on its class
+func (r *Resolver) resolveCall(call *ast.SubroutineCall) {
+	className := r.class.Name.Name
+	onVar := false
+	if call.Receiver != nil {
+		className = call.Receiver.Name
+		switch {
+		case r.methodTable.IndexOf(className) >= 0:
+			className = r.methodTable.TypeOf(className)
+			onVar = true
+		case r.classTable.IndexOf(className) >= 0:
+			r.checkField(call.Receiver)
+			className = r.classTable.TypeOf(className)
+			onVar = true
+		case r.classNames != nil && !r.classNames[className]:
+			r.errorf(call.Receiver, "undeclared class or variable %s", className)
+			return
+		}
+		if isPrimitive(className) {
+			r.errorf(call.Receiver, "%s is %s, only an object has subroutines", call.Receiver.Name, className)
+			return
+		}
+	}
+	class, ok := r.classes[className]
+	if !ok {
+		return
+	}
+	for _, sub := range class.Subroutines {
+		if sub.Name.Name != call.Name.Name {
+			continue
+		}
+		switch {
+		case onVar && sub.Kind != token.KeywordMethod:
+			r.errorf(call.Name, "%s %s.%s called on variable %s, call it on class %s", sub.Kind, className, sub.Name.Name, call.Receiver.Name, className)
+		case call.Receiver != nil && !onVar && sub.Kind == token.KeywordMethod:
+			r.errorf(call.Name, "method %s.%s called on class %s, call it on an object", className, sub.Name.Name, className)
+		// a bare call to a method passes this, which a function does not have
+		case call.Receiver == nil && sub.Kind == token.KeywordMethod && r.subroutine.Kind == token.KeywordFunction:
+			r.errorf(call.Name, "method %s called without an object from function %s", call.Name.Name, r.subroutine.Name.Name)
+		}
+		return
+	}
+	r.errorf(call.Name, "class %s has no subroutine %s", className, call.Name.Name)
+}
+
+func (r *Resolver) errorf(n ast.Node, format string, args ...interface{}) {
+	r.errors = append(r.errors, token.Diagnostic{Pos: n.Pos(), Msg: fmt.Sprintf(format, args...)})
+}
+
+func (r *Resolver) warnf(n ast.Node, format string, args ...interface{}) {
+	r.errors = append(r.errors, token.Diagnostic{Pos: n.Pos(), Msg: fmt.Sprintf(format, args...), Severity: token.SeverityWarning})
+}
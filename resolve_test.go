@@ -0,0 +1,205 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"compiler/ast"
+	"compiler/lexer"
+	"compiler/parser"
+	"compiler/token"
+)
+
+// resolveErrors resolves the classes in srcs together, each read from a file
+// named after the class
+func resolveErrors(t *testing.T, classNames []string, srcs ...string) []string {
+	t.Helper()
+	classes := make([]*ast.Class, 0, len(srcs))
+	for _, src := range srcs {
+		file := strings.Fields(src)[1] + ".jack"
+		classes = append(classes, parser.New(lexer.New(strings.NewReader(src), file)).CompileClass())
+	}
+	resolver := buildResolver(classes, classNames)
+	errs := make([]string, 0)
+	for _, class := range classes {
+		resolver.resolveClass(class)
+		for _, d := range resolver.errors {
+			errs = append(errs, d.Error())
+		}
+	}
+	return errs
+}
+
+func TestResolveReportsUndeclaredNames(t *testing.T) {
+	src := `class Main {
+    static int count;
+    function void main() {
+        var Point p;
+        var Circle c;
+        var Array a;
+        let cuont = 1;
+        let count = count + y;
+        let a[i] = b[count];
+        let p = Point.new(1, 2);
+        do p.mvoe(1, 2);
+        do Circle.draw(c);
+        do Sys.hlat();
+        do Screen.clearScreen();
+        do helper(p);
+        do missing();
+        return;
+    }
+    function void helper(Point p) { do p.move(1, 2); return; }
+}`
+	want := []string{
+		"Main.jack:5:13: undeclared class Circle",
+		"Main.jack:7:13: undeclared variable cuont",
+		"Main.jack:8:29: undeclared variable y",
+		"Main.jack:9:15: undeclared variable i",
+		"Main.jack:9:20: undeclared variable b",
+		"Main.jack:11:14: class Point has no subroutine mvoe",
+		"Main.jack:12:12: undeclared class or variable Circle",
+		"Main.jack:13:16: class Sys has no subroutine hlat",
+		"Main.jack:16:12: class Main has no subroutine missing",
+	}
+	got := resolveErrors(t, []string{"Main", "Point"}, src, pointSource)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// a class of the program that did not parse is still a class, and without
+// the names of the program only the known classes are checked
+func TestResolveKnownClasses(t *testing.T) {
+	src := `class Main {
+    function void main() {
+        var Circle c;
+        let c = Circle.new();
+        do Output.printInt(Circle.area(c));
+        do Output.printnt(1);
+        return;
+    }
+}`
+	want := []string{"Main.jack:6:19: class Output has no subroutine printnt"}
+	for _, classNames := range [][]string{{"Main", "Circle"}, nil} {
+		if got := resolveErrors(t, classNames, src); !reflect.DeepEqual(got, want) {
+			t.Errorf("with classes %q got errors %q", classNames, got)
+		}
+	}
+}
+
+func TestCompileReportsUndeclaredVariable(t *testing.T) {
+	src := "class Main { function void main() { var int count; let count = cuont + 1; return; } }"
+	var out strings.Builder
+	errs := compile(lexer.New(strings.NewReader(src), "Main.jack"), &out)
+	if len(errs) != 1 || errs[0].Error() != "Main.jack:1:64: undeclared variable cuont" {
+		t.Errorf("got errors %v", errs)
+	}
+	if out.Len() > 0 {
+		t.Errorf("wrote %q", out.String())
+	}
+}
+
+// a class compiled on its own knows only itself and the OS
+func TestCompileReportsUndeclaredClass(t *testing.T) {
+	src := "class Main { function void main() { var Foo f; do Foo.bar(); do Main.main(); do Math.abs(1); return; } }"
+	var out strings.Builder
+	var got []string
+	for _, d := range compile(lexer.New(strings.NewReader(src), "<stdin>"), &out) {
+		got = append(got, d.Error())
+	}
+	want := []string{"<stdin>:1:41: undeclared class Foo", "<stdin>:1:51: undeclared class or variable Foo"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors %q", got)
+	}
+}
+
+func TestResolveReportsRedeclarations(t *testing.T) {
+	src := `class Main {
+    field int x, x;
+    static boolean flag;
+    function void f(int a, char a) {
+        var int b, b;
+        var Array a;
+        var int flag;
+        return;
+    }
+    method void g(int x) { var int y; let y = x; return; }
+    function void f() { return; }
+}`
+	want := []string{
+		"Main.jack:2:18: x is already declared in class Main",
+		"Main.jack:4:33: a is already declared in subroutine f",
+		"Main.jack:5:20: b is already declared in subroutine f",
+		"Main.jack:6:19: a is already declared in subroutine f",
+		"Main.jack:7:17: warning: local variable flag shadows static variable flag",
+		"Main.jack:10:23: warning: argument x shadows field x",
+		"Main.jack:11:19: subroutine f is already declared in class Main",
+	}
+	if got := resolveErrors(t, nil, src); !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestResolveChecksTheFileName(t *testing.T) {
+	class := parser.New(lexer.New(strings.NewReader("class Game { }"), "dir/Main.jack")).CompileClass()
+	resolver := buildResolver([]*ast.Class{class}, nil)
+	resolver.resolveClass(class)
+	if len(resolver.errors) != 1 || resolver.errors[0].Error() != "dir/Main.jack:1:7: class Game is declared in Main.jack, it must be named Main" {
+		t.Errorf("got errors %v", resolver.errors)
+	}
+}
+
+// warnings are reported and the class still compiles
+func TestCompileWithWarnings(t *testing.T) {
+	src := "class Main { field int x; method int get(int x) { return x; } }"
+	var out strings.Builder
+	errs := compile(lexer.New(strings.NewReader(src), "Main.jack"), &out)
+	if len(errs) != 1 || errs[0].Severity != token.SeverityWarning || token.HasErrors(errs) {
+		t.Errorf("got errors %v", errs)
+	}
+	if out.Len() == 0 {
+		t.Error("no output")
+	}
+}
+
+// only an object has subroutines, and only a method or a constructor has this
+func TestResolveChecksReceivers(t *testing.T) {
+	src := `class Main {
+    field int n;
+    function void main() {
+        var int x;
+        var char c;
+        var Main m;
+        do x.foo();
+        do c.bar();
+        do m.run();
+        do run();
+        do helper();
+        do Main.run();
+        do m.helper();
+        let m = m.new();
+        let n = 3;
+        do m.run(this);
+        return;
+    }
+    method void run() { do run(); do helper(); do n.baz(); let n = n + 1; do Main.helper(); return; }
+    constructor Main new() { do run(); let n = 0; return this; }
+    function void helper() { return; }
+}`
+	want := []string{
+		"Main.jack:7:12: x is int, only an object has subroutines",
+		"Main.jack:8:12: c is char, only an object has subroutines",
+		"Main.jack:10:12: method run called without an object from function main",
+		"Main.jack:12:17: method Main.run called on class Main, call it on an object",
+		"Main.jack:13:14: function Main.helper called on variable m, call it on class Main",
+		"Main.jack:14:19: constructor Main.new called on variable m, call it on class Main",
+		"Main.jack:15:13: field n used in function main",
+		"Main.jack:16:18: this used in function main",
+		"Main.jack:19:51: n is int, only an object has subroutines",
+	}
+	if got := resolveErrors(t, nil, src); !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
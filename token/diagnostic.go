@@ -0,0 +1,35 @@
+package token
+
+import "fmt"
+
+// Severity tells whether a Diagnostic stops its class from compiling
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+// Diagnostic is an error found in the source, reported at the place it happened
+type Diagnostic struct {
+	Pos      Position
+	Msg      string
+	Severity Severity
+}
+
+func (d Diagnostic) Error() string {
+	if d.Severity == SeverityWarning {
+		return fmt.Sprintf("%s: warning: %s", d.Pos, d.Msg)
+	}
+	return fmt.Sprintf("%s: %s", d.Pos, d.Msg)
+}
+
+// HasErrors tells whether any of diagnostics is more than a warning
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+// Package token holds what the tokens of a Jack program and its syntax tree
+// share: positions in the source, keywords and symbols, and the diagnostics
+// reported at those positions
+package token
+
+import "fmt"
+
+// Position points at a byte in the original source file. Line and Column
+// start from 1.
+type Position struct {
+	File   string
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+type Keyword int
+
+const (
+	KeywordNone Keyword = iota // the token is not a keyword
+	KeywordClass
+	KeywordConstructor
+	KeywordFunction
+	KeywordMethod
+	KeywordField
+	KeywordStatic
+	KeywordVar
+	KeywordInt
+	KeywordChar
+	KeywordBoolean
+	KeywordVoid
+	KeywordTrue
+	KeywordFalse
+	KeywordNull
+	KeywordThis
+	KeywordLet
+	KeywordDo
+	KeywordIf
+	KeywordElse
+	KeywordWhile
+	KeywordReturn
+)
+
+var (
+	// indexed by Keyword
+	keywords = []string{"", "class", "constructor", "function", "method", "field", "static", "var", "int", "char", "boolean",
+		"void", "true", "false", "null", "this", "let", "do", "if", "else", "while", "return"}
+	keywordSet = make(map[string]Keyword)
+)
+
+func init() {
+	for k, str := range keywords {
+		if k > 0 {
+			keywordSet[str] = Keyword(k)
+		}
+	}
+}
+
+// Lookup returns the keyword spelled ident, KeywordNone when it is not one
+func Lookup(ident string) Keyword {
+	return keywordSet[ident]
+}
+
+// String is the spelling of the keyword, the same string for every call
+func (k Keyword) String() string {
+	if k > KeywordNone && int(k) < len(keywords) {
+		return keywords[k]
+	}
+	return fmt.Sprintf("Keyword(%d)", int(k))
+}
+
+// SymbolChar is a symbol token, its value is the character itself
+type SymbolChar byte
+
+const (
+	SymbolLBrace    SymbolChar = '{'
+	SymbolRBrace    SymbolChar = '}'
+	SymbolLBracket  SymbolChar = '['
+	SymbolRBracket  SymbolChar = ']'
+	SymbolLParen    SymbolChar = '('
+	SymbolRParen    SymbolChar = ')'
+	SymbolDot       SymbolChar = '.'
+	SymbolComma     SymbolChar = ','
+	SymbolSemicolon SymbolChar = ';'
+	SymbolPlus      SymbolChar = '+'
+	SymbolMinus     SymbolChar = '-'
+	SymbolStar      SymbolChar = '*'
+	SymbolSlash     SymbolChar = '/'
+	SymbolAnd       SymbolChar = '&'
+	SymbolOr        SymbolChar = '|'
+	SymbolLt        SymbolChar = '<'
+	SymbolGt        SymbolChar = '>'
+	SymbolEq        SymbolChar = '='
+	SymbolTilde     SymbolChar = '~'
+)
+
+func (s SymbolChar) String() string {
+	return string(rune(s))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"compiler/lexer"
+	"compiler/token"
+)
+
+/*
+Token dump, writes the token stream of a file without parsing it
+*/
+
+// tokenRecord is one line of the tokens-json output
+type tokenRecord struct {
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// dumpTokens writes every token of t to out. format is "tokens" for the
+// nand2tetris xxxT.xml format, "tokens-json" for one JSON object per line or
+// "tokens-text" for `line:col kind value` lines. The lexical errors are
+// returned, the dump goes on past them
+func dumpTokens(t *lexer.Tokenizer, out io.Writer, format string) ([]token.Diagnostic, error) {
+	var errs []token.Diagnostic
+	t.OnError = func(d token.Diagnostic) {
+		errs = append(errs, d)
+	}
+	w := bufio.NewWriter(out)
+	if format == "tokens" {
+		_, _ = w.WriteString("<tokens>\n")
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for {
+		tok := t.Advance()
+		if tok.Kind == lexer.TokenTypeEOF {
+			break
+		}
+		kind := tok.Kind.String()
+		value := tok.Text
+		if tok.Kind == lexer.TokenTypeStringConst {
+			value = tok.StrVal
+		}
+		switch format {
+		case "tokens":
+			_, _ = fmt.Fprintf(w, "<%s> %s </%s>\n", kind, escapeXml(value), kind)
+		case "tokens-json":
+			record := tokenRecord{Kind: kind, Value: value, File: tok.Pos.File, Line: tok.Pos.Line, Column: tok.Pos.Column}
+			if err := enc.Encode(record); err != nil {
+				return errs, err
+			}
+		case "tokens-text":
+			// the raw text keeps string constants quoted, so every line splits on the first two spaces
+			_, _ = fmt.Fprintf(w, "%d:%d %s %s\n", tok.Pos.Line, tok.Pos.Column, kind, tok.Text)
+		}
+	}
+	if format == "tokens" {
+		_, _ = w.WriteString("</tokens>\n")
+	}
+	return errs, w.Flush()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"compiler/lexer"
+)
+
+func TestDumpTokens(t *testing.T) {
+	path := writeJack(t, "Main.jack", "class Main {\n  function void f() { if (a < b & c > d) { do Output.printString(\"<&\"); } }\n}\n")
+	want := `<tokens>
+<keyword> class </keyword>
+<identifier> Main </identifier>
+<symbol> { </symbol>
+<keyword> function </keyword>
+<keyword> void </keyword>
+<identifier> f </identifier>
+<symbol> ( </symbol>
+<symbol> ) </symbol>
+<symbol> { </symbol>
+<keyword> if </keyword>
+<symbol> ( </symbol>
+<identifier> a </identifier>
+<symbol> &lt; </symbol>
+<identifier> b </identifier>
+<symbol> &amp; </symbol>
+<identifier> c </identifier>
+<symbol> &gt; </symbol>
+<identifier> d </identifier>
+<symbol> ) </symbol>
+<symbol> { </symbol>
+<keyword> do </keyword>
+<identifier> Output </identifier>
+<symbol> . </symbol>
+<identifier> printString </identifier>
+<symbol> ( </symbol>
+<stringConstant> &lt;&amp; </stringConstant>
+<symbol> ) </symbol>
+<symbol> ; </symbol>
+<symbol> } </symbol>
+<symbol> } </symbol>
+<symbol> } </symbol>
+</tokens>
+`
+	var out strings.Builder
+	if _, err := dumpTokens(buildTokenizer(path), &out, "tokens"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestDumpTokensJsonAndText(t *testing.T) {
+	path := writeJack(t, "Main.jack", "class Main {\n\tfield String s; // \"x\"\n}")
+	var out strings.Builder
+	if _, err := dumpTokens(buildTokenizer(path), &out, "tokens-text"); err != nil {
+		t.Fatal(err)
+	}
+	want := "1:1 keyword class\n1:7 identifier Main\n1:12 symbol {\n2:2 keyword field\n2:8 identifier String\n2:15 identifier s\n2:16 symbol ;\n3:1 symbol }\n"
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if _, err := dumpTokens(buildTokenizer(path), &out, "tokens-json"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	wantFirst := `{"kind":"keyword","value":"class","file":"` + path + `","line":1,"column":1}`
+	if len(lines) != 8 || lines[0] != wantFirst {
+		t.Errorf("got\n%s", out.String())
+	}
+}
+
+// a lexical error is reported and the other files are still dumped
+func TestCompileProgramDumpsTokensPastErrors(t *testing.T) {
+	defer func(old string) { *emit = old }(*emit)
+	*emit = "tokens-text"
+	outs := []io.Writer{&strings.Builder{}, &strings.Builder{}}
+	errs := compileProgram([]*lexer.Tokenizer{
+		lexer.New(strings.NewReader("class A { @ field # int x; }"), "A.jack"),
+		lexer.New(strings.NewReader("class B { }"), "B.jack"),
+	}, outs, nil)
+	if len(errs[0]) != 2 || errs[0][1].Error() != "A.jack:1:19: illegal character '#'" || len(errs[1]) > 0 {
+		t.Errorf("got errors %v", errs)
+	}
+	if !strings.Contains(outs[0].(*strings.Builder).String(), "1:21 keyword int") || outs[1].(*strings.Builder).Len() == 0 {
+		t.Errorf("got dumps %q and %q", outs[0], outs[1])
+	}
+}
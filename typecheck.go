@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+
+	"compiler/ast"
+	"compiler/token"
+)
+
+/*
+TypeChecker checks the types of the statements and expressions of a program
+against the declarations of its variables and the signatures of its classes
+and of the OS
+*/
+
+const (
+	typeInt     = "int"
+	typeChar    = "char"
+	typeBoolean = "boolean"
+	typeVoid    = "void"
+	typeString  = "String"
+	typeArray   = "Array"
+	typeNull    = "null" // the type of null, which fits any class
+	typeUnknown = ""     // the type of an array element or a call to an unknown subroutine, which fits anything
+)
+
+type TypeChecker struct {
+	// strict keeps int, char and boolean apart and an Array from other
+	// classes, permissive lets them mix as the VM does
+	strict      bool
+	classes     map[string]*ast.Class // the classes of the program and of the OS by name
+	errors      []token.Diagnostic
+	classTable  *ast.SymbolTable // the Symbols of class
+	methodTable *ast.SymbolTable // the Symbols of subroutine
+	class       *ast.Class
+	subroutine  *ast.SubroutineDec
+}
+
+// buildTypeChecker checks against the classes given and the OS classes, a
+// class of the program can take the place of an OS class
+func buildTypeChecker(classes []*ast.Class, strict bool) *TypeChecker {
+	c := &TypeChecker{
+		strict:  strict,
+		classes: make(map[string]*ast.Class),
+	}
+	for _, class := range getOSClasses() {
+		c.classes[class.Name.Name] = class
+	}
+	for _, class := range classes {
+		c.classes[class.Name.Name] = class
+	}
+	return c
+}
+
+// checkClass leaves the errors of the class in c.errors, the class must have
+// been resolved
+func (c *TypeChecker) checkClass(class *ast.Class) {
+	if class.Symbols == nil {
+		panic("class " + class.Name.Name + " is not resolved")
+	}
+	c.errors = nil
+	c.class = class
+	c.classTable = class.Symbols
+	for _, sub := range class.Subroutines {
+		c.checkSubroutine(sub)
+	}
+}
+
+func (c *TypeChecker) checkSubroutine(sub *ast.SubroutineDec) {
+	c.subroutine = sub
+	c.methodTable = sub.Symbols
+	c.checkStatements(sub.Body.Statements)
+}
+
+func (c *TypeChecker) checkStatements(statements []ast.Statement) {
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *ast.LetStatement:
+			want := c.typeOfVar(s.Name.Name)
+			if s.Index != nil {
+				c.checkIndex(s.Name, s.Index)
+				want = typeUnknown
+			}
+			if got := c.typeOf(s.Value); !c.assignable(want, got) {
+				c.errorf(s.Value, "cannot assign %s to %s variable %s", got, want, s.Name.Name)
+			}
+		case *ast.IfStatement:
+			c.checkCondition("if", s.Condition)
+			c.checkStatements(s.Then)
+			c.checkStatements(s.Else)
+		case *ast.WhileStatement:
+			c.checkCondition("while", s.Condition)
+			c.checkStatements(s.Body)
+		case *ast.DoStatement:
+			c.checkCall(s.Call)
+		case *ast.ReturnStatement:
+			want := c.subroutine.ReturnType.Name
+			switch {
+			case s.Value == nil && want != typeVoid:
+				c.errorf(s, "missing return value, %s returns %s", c.subroutine.Name.Name, want)
+			case s.Value != nil && want == typeVoid:
+				c.errorf(s.Value, "%s returns void, it cannot return a value", c.subroutine.Name.Name)
+			case s.Value != nil:
+				if got := c.typeOf(s.Value); !c.assignable(want, got) {
+					c.errorf(s.Value, "cannot return %s from %s, it returns %s", got, c.subroutine.Name.Name, want)
+				}
+			}
+		}
+	}
+}
+
+func (c *TypeChecker) checkCondition(statement string, condition ast.Expression) {
+	if got := c.typeOf(condition); !c.assignable(typeBoolean, got) {
+		c.errorf(condition, "condition of %s is %s, want boolean", statement, got)
+	}
+}
+
+// typeOf checks an expression and returns its type
+func (c *TypeChecker) typeOf(expr ast.Expression) string {
+	switch e := expr.(type) {
+	case *ast.IntegerConstant:
+		return typeInt
+	case *ast.StringConstant:
+		return typeString
+	case *ast.KeywordConstant:
+		switch e.Value {
+		case token.KeywordTrue, token.KeywordFalse:
+			return typeBoolean
+		case token.KeywordNull:
+			return typeNull
+		}
+		return c.class.Name.Name
+	case *ast.VarRef:
+		return c.typeOfVar(e.Name.Name)
+	case *ast.ArrayAccess:
+		c.checkIndex(e.Name, e.Index)
+		return typeUnknown
+	case *ast.ParenExpression:
+		return c.typeOf(e.Inner)
+	case *ast.SubroutineCall:
+		t := c.checkCall(e)
+		if t == typeVoid {
+			// the VM gives 0, which the permissive mode takes for any type
+			if c.strict {
+				c.errorf(e, "%s returns void, it has no value", e.Name.Name)
+			}
+			return typeUnknown
+		}
+		return t
+	case *ast.UnaryExpression:
+		operand := c.typeOf(e.Operand)
+		if e.Op == token.SymbolMinus {
+			c.checkOperand(e, e.Operand, operand, typeInt)
+			return typeInt
+		}
+		want := logicalType(operand, typeBoolean)
+		c.checkOperand(e, e.Operand, operand, want)
+		return want
+	case *ast.BinaryExpression:
+		first, ops := ast.Chain(e)
+		left := c.typeOf(first)
+		for _, op := range ops {
+			left = c.binaryType(op, left, c.typeOf(op.Right))
+		}
+		return left
+	}
+	panic(fmt.Sprintf("unknown expression %T", expr))
+}
+
+// binaryType checks the operand types of a binary expression and returns its type
+func (c *TypeChecker) binaryType(e *ast.BinaryExpression, left string, right string) string {
+	switch e.Op {
+	case token.SymbolPlus, token.SymbolMinus, token.SymbolStar, token.SymbolSlash:
+		c.checkOperand(e, e.Left, left, typeInt)
+		c.checkOperand(e, e.Right, right, typeInt)
+		return typeInt
+	case token.SymbolAnd, token.SymbolOr:
+		want := logicalType(left, right)
+		c.checkOperand(e, e.Left, left, want)
+		c.checkOperand(e, e.Right, right, want)
+		return want
+	case token.SymbolLt, token.SymbolGt:
+		c.checkOperand(e, e.Left, left, typeInt)
+		c.checkOperand(e, e.Right, right, typeInt)
+	case token.SymbolEq:
+		if !c.assignable(left, right) && !c.assignable(right, left) {
+			c.errorf(e, "cannot compare %s with %s", left, right)
+		}
+	}
+	return typeBoolean
+}
+
+// logicalType is the type of ~, & and |, which work bit by bit on ints as
+// well as on booleans, the operands are both of it
+func logicalType(left string, right string) string {
+	if left == typeInt || right == typeInt {
+		return typeInt
+	}
+	return typeBoolean
+}
+
+func (c *TypeChecker) checkOperand(op ast.Expression, operand ast.Expression, got string, want string) {
+	if !c.assignable(want, got) {
+		c.errorf(operand, "operand of %s is %s, want %s", operatorOf(op), got, want)
+	}
+}
+
+func operatorOf(op ast.Expression) string {
+	if unary, ok := op.(*ast.UnaryExpression); ok {
+		return unary.Op.String()
+	}
+	return op.(*ast.BinaryExpression).Op.String()
+}
+
+func (c *TypeChecker) checkIndex(name *ast.Identifier, index ast.Expression) {
+	if t := c.typeOfVar(name.Name); c.strict && t != typeArray && t != typeUnknown {
+		c.errorf(name, "%s is %s, only an Array can be indexed", name.Name, t)
+	}
+	if got := c.typeOf(index); !c.assignable(typeInt, got) {
+		c.errorf(index, "index of %s is %s, want int", name.Name, got)
+	}
+}
+
+// checkCall checks the arguments of a call against the parameters of the
+// subroutine it calls and returns what the subroutine returns
+func (c *TypeChecker) checkCall(call *ast.SubroutineCall) string {
+	args := make([]string, 0, len(call.Args))
+	for _, arg := range call.Args {
+		args = append(args, c.typeOf(arg))
+	}
+	className, sub := c.lookupSubroutine(call)
+	if sub == nil {
+		return typeUnknown
+	}
+	name := className + "." + sub.Name.Name
+	if len(args) != len(sub.Params) {
+		c.errorf(call, "%s takes %d arguments, got %d", name, len(sub.Params), len(args))
+		return sub.ReturnType.Name
+	}
+	for i, param := range sub.Params {
+		if !c.assignable(param.Type.Name, args[i]) {
+			c.errorf(call.Args[i], "argument %s of %s is %s, want %s", param.Name.Name, name, args[i], param.Type.Name)
+		}
+	}
+	return sub.ReturnType.Name
+}
+
+// lookupSubroutine finds the class and the declaration of the subroutine a
+// call calls, the declaration is nil when it is not known
+func (c *TypeChecker) lookupSubroutine(call *ast.SubroutineCall) (string, *ast.SubroutineDec) {
+	className := c.class.Name.Name
+	if call.Receiver != nil {
+		className = call.Receiver.Name
+		if t := c.typeOfVar(call.Receiver.Name); t != typeUnknown {
+			className = t
+		}
+	}
+	class, ok := c.classes[className]
+	if !ok {
+		return className, nil
+	}
+	for _, sub := range class.Subroutines {
+		if sub.Name.Name == call.Name.Name {
+			return className, sub
+		}
+	}
+	return className, nil
+}
+
+// typeOfVar is the declared type of a variable, typeUnknown when there is no
+// variable of that name
+func (c *TypeChecker) typeOfVar(name string) string {
+	if c.methodTable.IndexOf(name) >= 0 {
+		return c.methodTable.TypeOf(name)
+	}
+	if c.classTable.IndexOf(name) >= 0 {
+		return c.classTable.TypeOf(name)
+	}
+	return typeUnknown
+}
+
+// assignable tells whether a value of type got can go where want is expected
+func (c *TypeChecker) assignable(want string, got string) bool {
+	if want == got || want == typeUnknown || got == typeUnknown {
+		return true
+	}
+	wantObject, gotObject := !isPrimitive(want), !isPrimitive(got)
+	switch {
+	case got == typeNull:
+		return wantObject || !c.strict
+	case want == typeChar && got == typeInt:
+		// Jack has no char literal, a char is set and compared with its code
+		return true
+	case want == typeArray && gotObject:
+		// any object can be used as the block of memory it is, as
+		// Memory.deAlloc(this) does
+		return true
+	case c.strict:
+		return false
+	}
+	// the VM has only 16 bit words: the primitive types are all the same,
+	// and an Array is any address
+	return !wantObject && !gotObject || want == typeArray || got == typeArray
+}
+
+func isPrimitive(t string) bool {
+	return t == typeInt || t == typeChar || t == typeBoolean
+}
+
+func (c *TypeChecker) errorf(n ast.Node, format string, args ...interface{}) {
+	c.errors = append(c.errors, token.Diagnostic{Pos: n.Pos(), Msg: fmt.Sprintf(format, args...)})
+}
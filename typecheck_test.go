@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"compiler/ast"
+	"compiler/lexer"
+	"compiler/token"
+)
+
+// typeErrors resolves and checks the classes in srcs together, the first one
+// is Main.jack. Only the type errors are returned
+func typeErrors(t *testing.T, strict bool, srcs ...string) []string {
+	t.Helper()
+	classes := make([]*ast.Class, 0, len(srcs))
+	for _, src := range srcs {
+		classes = append(classes, parse(t, src))
+	}
+	resolver := buildResolver(classes, nil)
+	checker := buildTypeChecker(classes, strict)
+	errs := make([]string, 0)
+	for _, class := range classes {
+		resolver.resolveClass(class)
+		checker.checkClass(class)
+		for _, d := range checker.errors {
+			errs = append(errs, d.Error())
+		}
+	}
+	return errs
+}
+
+const pointSource = `class Point {
+    field int x, y;
+    constructor Point new(int ax, int ay) { let x = ax; let y = ay; return this; }
+    method int getX() { return x; }
+    method void move(int dx, int dy) { let x = x + dx; return; }
+}`
+
+func TestTypeCheckPermissive(t *testing.T) {
+	src := `class Main {
+    function void main() {
+        var int i;
+        var char c;
+        var boolean b;
+        var String s;
+        var Point p;
+        var Array a;
+        let i = "hi";
+        let c = i + 1;
+        let b = i;
+        let s = Keyboard.readLine(1);
+        let p = Point.new(1);
+        let p = Point.new(1, s);
+        let i = p.getX() + p;
+        let a = p;
+        let a[s] = p;
+        let p = null;
+        if (s) { do p.move(1, 2); }
+        while (~(i < c)) { let i = Math.max(i, c); }
+        do Output.printString(i);
+        do undefined.call(i, s, p);
+        return 1;
+    }
+    function int f() {
+        if (true) { return; }
+        return Point.new(0, 0);
+    }
+}`
+	want := []string{
+		"Main.jack:9:17: cannot assign String to int variable i",
+		"Main.jack:12:35: argument message of Keyboard.readLine is int, want String",
+		"Main.jack:13:17: Point.new takes 2 arguments, got 1",
+		"Main.jack:14:30: argument ay of Point.new is String, want int",
+		"Main.jack:15:28: operand of + is Point, want int",
+		"Main.jack:17:15: index of a is String, want int",
+		"Main.jack:19:13: condition of if is String, want boolean",
+		"Main.jack:21:31: argument s of Output.printString is int, want String",
+		"Main.jack:23:16: main returns void, it cannot return a value",
+		"Main.jack:26:21: missing return value, f returns int",
+		"Main.jack:27:16: cannot return Point from f, it returns int",
+	}
+	if got := typeErrors(t, false, src, pointSource); !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestTypeCheckStrict(t *testing.T) {
+	src := `class Main {
+    function void main() {
+        var int i;
+        var char c;
+        var boolean b;
+        var Point p;
+        var Array a;
+        let c = i;
+        let b = 1;
+        let i = c + 1;
+        let a = Memory.alloc(2);
+        let p = a;
+        let i = i | 1;
+        let b = b & i;
+        let i = ~i;
+        let i = i[0];
+        let i = Output.println();
+        let p = null;
+        do Memory.deAlloc(p);
+        if (b & (i < 3)) { let b = ~b; }
+        return;
+    }
+}`
+	want := []string{
+		"Main.jack:9:17: cannot assign int to boolean variable b",
+		"Main.jack:10:17: operand of + is char, want int",
+		"Main.jack:12:17: cannot assign Array to Point variable p",
+		"Main.jack:14:17: operand of & is boolean, want int",
+		"Main.jack:14:17: cannot assign int to boolean variable b",
+		"Main.jack:16:17: i is int, only an Array can be indexed",
+		"Main.jack:17:17: println returns void, it has no value",
+	}
+	got := typeErrors(t, true, src, pointSource)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got := typeErrors(t, false, src, pointSource); len(got) > 0 {
+		t.Errorf("permissive mode reports %q", got)
+	}
+}
+
+// the programs of the course pass strict mode, where a char is set and
+// compared with an int and & and | work on ints
+func TestTypeCheckStrictTestdata(t *testing.T) {
+	for _, dir := range []string{"ArrayTest", "Square"} {
+		sources, err := filepath.Glob(filepath.Join("testdata", dir, "*.jack"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		srcs := make([]string, len(sources))
+		for i, source := range sources {
+			src, err := os.ReadFile(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			srcs[i] = string(src)
+		}
+		if got := typeErrors(t, true, srcs...); len(got) > 0 {
+			t.Errorf("%s: got errors\n%s", dir, strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestCompileProgramChecksAcrossClasses(t *testing.T) {
+	main := "class Main { function void main() { var Point p; let p = Point.new(1, 2, 3); return; } }"
+	compile := func() ([][]token.Diagnostic, []io.Writer) {
+		outs := []io.Writer{&bytes.Buffer{}, &bytes.Buffer{}}
+		return compileProgram([]*lexer.Tokenizer{
+			lexer.New(strings.NewReader(main), "Main.jack"),
+			lexer.New(strings.NewReader(pointSource), "Point.jack"),
+		}, outs, nil), outs
+	}
+
+	// type checking is off unless asked for
+	if errs, outs := compile(); len(errs[0]) > 0 || len(errs[1]) > 0 || outs[0].(*bytes.Buffer).Len() == 0 {
+		t.Errorf("without -typecheck got errors %v", errs)
+	}
+
+	defer func(old string) { *typecheck = old }(*typecheck)
+	*typecheck = "permissive"
+	errs, outs := compile()
+	if len(errs[0]) != 1 || errs[0][0].Error() != "Main.jack:1:58: Point.new takes 2 arguments, got 3" || len(errs[1]) > 0 {
+		t.Errorf("got errors %v", errs)
+	}
+	if outs[0].(*bytes.Buffer).Len() > 0 || outs[1].(*bytes.Buffer).Len() == 0 {
+		t.Errorf("Main has output or Point has none")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"compiler/ast"
+	"compiler/token"
+)
+
+// recorder writes down the nodes it sees, +kind before the children and
+// -kind after them
+type recorder struct {
+	seen []string
+	skip string
+}
+
+func (r *recorder) Pre(n ast.Node) bool {
+	kind := strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast.")
+	r.seen = append(r.seen, "+"+kind)
+	return kind != r.skip
+}
+
+func (r *recorder) Post(n ast.Node) {
+	r.seen = append(r.seen, "-"+strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast."))
+}
+
+func TestWalkVisitsInSourceOrder(t *testing.T) {
+	class := parse(t, "class Main { function void f(int x) { let x = -x; return; } }")
+	r := &recorder{}
+	ast.Walk(r, class)
+	want := []string{
+		"+Class", "+Identifier", "-Identifier",
+		"+SubroutineDec", "+Type", "-Type", "+Identifier", "-Identifier",
+		"+Parameter", "+Type", "-Type", "+Identifier", "-Identifier", "-Parameter",
+		"+SubroutineBody",
+		"+LetStatement", "+Identifier", "-Identifier",
+		"+UnaryExpression", "+VarRef", "+Identifier", "-Identifier", "-VarRef", "-UnaryExpression",
+		"-LetStatement",
+		"+ReturnStatement", "-ReturnStatement",
+		"-SubroutineBody", "-SubroutineDec", "-Class",
+	}
+	if !reflect.DeepEqual(r.seen, want) {
+		t.Errorf("got\n%v\nwant\n%v", r.seen, want)
+	}
+
+	r = &recorder{skip: "LetStatement"}
+	ast.Walk(r, class.Subroutines[0].Body)
+	want = []string{"+SubroutineBody", "+LetStatement", "+ReturnStatement", "-ReturnStatement", "-SubroutineBody"}
+	if !reflect.DeepEqual(r.seen, want) {
+		t.Errorf("skipping let: got %v, want %v", r.seen, want)
+	}
+}
+
+// callCounter counts the calls in each subroutine, except in if statements
+type callCounter struct {
+	ast.BaseVisitor
+	calls  int
+	counts []string
+}
+
+func (c *callCounter) VisitSubroutineCall(*ast.SubroutineCall) bool {
+	c.calls++
+	return true
+}
+
+func (c *callCounter) VisitIfStatement(*ast.IfStatement) bool {
+	return false
+}
+
+func (c *callCounter) LeaveSubroutineDec(n *ast.SubroutineDec) {
+	c.counts = append(c.counts, fmt.Sprintf("%s %d", n.Name.Name, c.calls))
+	c.calls = 0
+}
+
+func TestWalkTypedCallsTheHooksOfEachType(t *testing.T) {
+	class := parse(t, `class Main {
+    function void main() {
+        do Output.printInt(Math.max(1, 2));
+        if (true) { do Sys.halt(); }
+        return;
+    }
+    function void f() { do Main.main(); return; }
+}`)
+	c := &callCounter{}
+	ast.WalkTyped(c, class)
+	want := []string{"main 2", "f 1"}
+	if !reflect.DeepEqual(c.counts, want) {
+		t.Errorf("got %v, want %v", c.counts, want)
+	}
+}
+
+func TestInspectFindsBannedCalls(t *testing.T) {
+	class := parse(t, `class Main {
+    function void main() {
+        if (true) { do Sys.halt(); }
+        let x = Math.max(Sys.wait(1), 2);
+        return;
+    }
+}`)
+	found := make([]string, 0)
+	ast.Inspect(class, func(n ast.Node) bool {
+		if call, ok := n.(*ast.SubroutineCall); ok && call.Receiver != nil && call.Receiver.Name == "Sys" {
+			found = append(found, fmt.Sprintf("%s Sys.%s", call.Pos(), call.Name.Name))
+		}
+		return true
+	})
+	want := []string{"Main.jack:3:24 Sys.halt", "Main.jack:4:26 Sys.wait"}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("found %v, want %v", found, want)
+	}
+}
+
+func TestRewriteReplacesNodes(t *testing.T) {
+	class := parse(t, `class Main {
+    function void main() {
+        var int count;
+        let count = 1;
+        do Sys.wait(count);
+        while (count < 3) { do Sys.wait(1); let count = count + 1; }
+        return;
+    }
+}`)
+	replaced := ast.Rewrite(ast.RewriteFunc(func(n ast.Node) ast.Node {
+		switch n := n.(type) {
+		case *ast.Identifier:
+			if n.Name == "count" {
+				n.Name = "n"
+			}
+		case *ast.DoStatement:
+			if n.Call.Receiver != nil && n.Call.Receiver.Name == "Sys" && n.Call.Name.Name == "wait" {
+				return nil
+			}
+		case *ast.IntegerConstant:
+			return &ast.BinaryExpression{Span: n.Span, Op: token.SymbolStar, Left: n, Right: &ast.IntegerConstant{Span: n.Span, Value: 2}}
+		}
+		return n
+	}), class)
+	if replaced != class {
+		t.Fatalf("class replaced by %T", replaced)
+	}
+
+	var out bytes.Buffer
+	buildXMLWriter(&out).writeClass(class, 0)
+	got := out.String()
+	if strings.Contains(got, "count") || strings.Contains(got, "wait") {
+		t.Errorf("count or wait left in\n%s", got)
+	}
+	if statements := class.Subroutines[0].Body.Statements; len(statements) != 3 ||
+		len(statements[1].(*ast.WhileStatement).Body) != 1 {
+		t.Errorf("Sys.wait calls not removed")
+	}
+	let := class.Subroutines[0].Body.Statements[0].(*ast.LetStatement)
+	if mul, ok := let.Value.(*ast.BinaryExpression); !ok || mul.Op != token.SymbolStar {
+		t.Errorf("1 rewritten to %T", let.Value)
+	}
+}
+
+func TestRewritePanicsOnMisfit(t *testing.T) {
+	class := parse(t, "class Main { function void f() { do g(); return; } }")
+	defer func() {
+		if r := recover(); r != "*ast.SubroutineCall rewritten to *ast.VarRef" {
+			t.Errorf("recovered %v", r)
+		}
+	}()
+	ast.Rewrite(ast.RewriteFunc(func(n ast.Node) ast.Node {
+		if call, ok := n.(*ast.SubroutineCall); ok {
+			return &ast.VarRef{Span: call.Span, Name: call.Name}
+		}
+		return n
+	}), class)
+}
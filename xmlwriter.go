@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"compiler/ast"
+)
+
+/*
+XMLWriter writes the parse tree of a class in the nand2tetris xml format,
+byte for byte the same as the reference files of the course
+*/
+
+type XMLWriter struct {
+	Out io.Writer
+}
+
+func buildXMLWriter(out io.Writer) *XMLWriter {
+	return &XMLWriter{
+		Out: out,
+	}
+}
+
+func (w *XMLWriter) writeClass(class *ast.Class, depth int) {
+	w.writePureTag("class", true, depth)
+	w.writeTag("keyword", "class", depth+1)
+	w.writeTag("identifier", class.Name.Name, depth+1)
+	w.writeTag("symbol", "{", depth+1)
+	for _, dec := range class.VarDecs {
+		w.writeClassVarDec(dec, depth+1)
+	}
+	for _, sub := range class.Subroutines {
+		w.writeSubroutine(sub, depth+1)
+	}
+	w.writeTag("symbol", "}", depth+1)
+	w.writePureTag("class", false, depth)
+}
+
+func (w *XMLWriter) writeClassVarDec(dec *ast.ClassVarDec, depth int) {
+	w.writePureTag("classVarDec", true, depth)
+	w.writeTag("keyword", dec.Kind.String(), depth+1)
+	w.writeType(dec.Type, depth+1)
+	w.writeNames(dec.Names, depth+1)
+	w.writeTag("symbol", ";", depth+1)
+	w.writePureTag("classVarDec", false, depth)
+}
+
+func (w *XMLWriter) writeSubroutine(sub *ast.SubroutineDec, depth int) {
+	w.writePureTag("subroutineDec", true, depth)
+	w.writeTag("keyword", sub.Kind.String(), depth+1)
+	w.writeType(sub.ReturnType, depth+1)
+	w.writeTag("identifier", sub.Name.Name, depth+1)
+	w.writeTag("symbol", "(", depth+1)
+	w.writeParameterList(sub.Params, depth+1)
+	w.writeTag("symbol", ")", depth+1)
+	w.writeSubroutineBody(sub.Body, depth+1)
+	w.writePureTag("subroutineDec", false, depth)
+}
+
+func (w *XMLWriter) writeParameterList(params []*ast.Parameter, depth int) {
+	w.writePureTag("parameterList", true, depth)
+	for i, param := range params {
+		if i > 0 {
+			w.writeTag("symbol", ",", depth+1)
+		}
+		w.writeType(param.Type, depth+1)
+		w.writeTag("identifier", param.Name.Name, depth+1)
+	}
+	w.writePureTag("parameterList", false, depth)
+}
+
+func (w *XMLWriter) writeSubroutineBody(body *ast.SubroutineBody, depth int) {
+	w.writePureTag("subroutineBody", true, depth)
+	w.writeTag("symbol", "{", depth+1)
+	for _, dec := range body.VarDecs {
+		w.writeVarDec(dec, depth+1)
+	}
+	w.writeStatements(body.Statements, depth+1)
+	w.writeTag("symbol", "}", depth+1)
+	w.writePureTag("subroutineBody", false, depth)
+}
+
+func (w *XMLWriter) writeVarDec(dec *ast.VarDec, depth int) {
+	w.writePureTag("varDec", true, depth)
+	w.writeTag("keyword", "var", depth+1)
+	w.writeType(dec.Type, depth+1)
+	w.writeNames(dec.Names, depth+1)
+	w.writeTag("symbol", ";", depth+1)
+	w.writePureTag("varDec", false, depth)
+}
+
+func (w *XMLWriter) writeStatements(statements []ast.Statement, depth int) {
+	w.writePureTag("statements", true, depth)
+	for _, statement := range statements {
+		switch s := statement.(type) {
+		case *ast.LetStatement:
+			w.writeLet(s, depth+1)
+		case *ast.DoStatement:
+			w.writeDo(s, depth+1)
+		case *ast.IfStatement:
+			w.writeIf(s, depth+1)
+		case *ast.ReturnStatement:
+			w.writeReturn(s, depth+1)
+		case *ast.WhileStatement:
+			w.writeWhile(s, depth+1)
+		}
+	}
+	w.writePureTag("statements", false, depth)
+}
+
+func (w *XMLWriter) writeLet(let *ast.LetStatement, depth int) {
+	w.writePureTag("letStatement", true, depth)
+	w.writeTag("keyword", "let", depth+1)
+	w.writeTag("identifier", let.Name.Name, depth+1)
+	if let.Index != nil {
+		w.writeTag("symbol", "[", depth+1)
+		w.writeExpression(let.Index, depth+1)
+		w.writeTag("symbol", "]", depth+1)
+	}
+	w.writeTag("symbol", "=", depth+1)
+	w.writeExpression(let.Value, depth+1)
+	w.writeTag("symbol", ";", depth+1)
+	w.writePureTag("letStatement", false, depth)
+}
+
+func (w *XMLWriter) writeIf(stmt *ast.IfStatement, depth int) {
+	w.writePureTag("ifStatement", true, depth)
+	w.writeTag("keyword", "if", depth+1)
+	w.writeTag("symbol", "(", depth+1)
+	w.writeExpression(stmt.Condition, depth+1)
+	w.writeTag("symbol", ")", depth+1)
+	w.writeBlock(stmt.Then, depth+1)
+	if stmt.HasElse {
+		w.writeTag("keyword", "else", depth+1)
+		w.writeBlock(stmt.Else, depth+1)
+	}
+	w.writePureTag("ifStatement", false, depth)
+}
+
+func (w *XMLWriter) writeWhile(stmt *ast.WhileStatement, depth int) {
+	w.writePureTag("whileStatement", true, depth)
+	w.writeTag("keyword", "while", depth+1)
+	w.writeTag("symbol", "(", depth+1)
+	w.writeExpression(stmt.Condition, depth+1)
+	w.writeTag("symbol", ")", depth+1)
+	w.writeBlock(stmt.Body, depth+1)
+	w.writePureTag("whileStatement", false, depth)
+}
+
+func (w *XMLWriter) writeDo(stmt *ast.DoStatement, depth int) {
+	w.writePureTag("doStatement", true, depth)
+	w.writeTag("keyword", "do", depth+1)
+	w.writeSubroutineCall(stmt.Call, depth+1)
+	w.writeTag("symbol", ";", depth+1)
+	w.writePureTag("doStatement", false, depth)
+}
+
+func (w *XMLWriter) writeReturn(stmt *ast.ReturnStatement, depth int) {
+	w.writePureTag("returnStatement", true, depth)
+	w.writeTag("keyword", "return", depth+1)
+	if stmt.Value != nil {
+		w.writeExpression(stmt.Value, depth+1)
+	}
+	w.writeTag("symbol", ";", depth+1)
+	w.writePureTag("returnStatement", false, depth)
+}
+
+func (w *XMLWriter) writeExpression(expr ast.Expression, depth int) {
+	w.writePureTag("expression", true, depth)
+	w.writeOperands(expr, depth+1)
+	w.writePureTag("expression", false, depth)
+}
+
+// writeOperands flattens the left nested operators of an expression back
+// into the term (op term)* sequence of the grammar
+func (w *XMLWriter) writeOperands(expr ast.Expression, depth int) {
+	binary, ok := expr.(*ast.BinaryExpression)
+	if !ok {
+		w.writeTerm(expr, depth)
+		return
+	}
+	first, ops := ast.Chain(binary)
+	w.writeTerm(first, depth)
+	for _, op := range ops {
+		w.writeTag("symbol", op.Op.String(), depth)
+		w.writeTerm(op.Right, depth)
+	}
+}
+
+func (w *XMLWriter) writeTerm(term ast.Expression, depth int) {
+	// a chain of unary operators opens a term each, in a loop rather than
+	// one call per operator
+	outer := depth
+	for unary, ok := term.(*ast.UnaryExpression); ok; unary, ok = term.(*ast.UnaryExpression) {
+		w.writePureTag("term", true, depth)
+		w.writeTag("symbol", unary.Op.String(), depth+1)
+		term = unary.Operand
+		depth++
+	}
+
+	w.writePureTag("term", true, depth)
+	switch t := term.(type) {
+	case *ast.IntegerConstant:
+		w.writeTag("integerConstant", fmt.Sprint(t.Value), depth+1)
+	case *ast.StringConstant:
+		w.writeTag("stringConstant", t.Value, depth+1)
+	case *ast.KeywordConstant:
+		w.writeTag("keyword", t.Value.String(), depth+1)
+	case *ast.ParenExpression:
+		w.writeTag("symbol", "(", depth+1)
+		w.writeExpression(t.Inner, depth+1)
+		w.writeTag("symbol", ")", depth+1)
+	case *ast.VarRef:
+		w.writeTag("identifier", t.Name.Name, depth+1)
+	case *ast.ArrayAccess:
+		w.writeTag("identifier", t.Name.Name, depth+1)
+		w.writeTag("symbol", "[", depth+1)
+		w.writeExpression(t.Index, depth+1)
+		w.writeTag("symbol", "]", depth+1)
+	case *ast.SubroutineCall:
+		w.writeSubroutineCall(t, depth+1)
+	}
+	for ; depth >= outer; depth-- {
+		w.writePureTag("term", false, depth)
+	}
+}
+
+func (w *XMLWriter) writeSubroutineCall(call *ast.SubroutineCall, depth int) {
+	if call.Receiver != nil {
+		w.writeTag("identifier", call.Receiver.Name, depth)
+		w.writeTag("symbol", ".", depth)
+	}
+	w.writeTag("identifier", call.Name.Name, depth)
+	w.writeTag("symbol", "(", depth)
+	w.writeExpressionList(call.Args, depth)
+	w.writeTag("symbol", ")", depth)
+}
+
+func (w *XMLWriter) writeExpressionList(exprs []ast.Expression, depth int) {
+	w.writePureTag("expressionList", true, depth)
+	for i, expr := range exprs {
+		if i > 0 {
+			w.writeTag("symbol", ",", depth+1)
+		}
+		w.writeExpression(expr, depth+1)
+	}
+	w.writePureTag("expressionList", false, depth)
+}
+
+// { statements }
+func (w *XMLWriter) writeBlock(statements []ast.Statement, depth int) {
+	w.writeTag("symbol", "{", depth)
+	w.writeStatements(statements, depth)
+	w.writeTag("symbol", "}", depth)
+}
+
+// varName (, varName)*
+func (w *XMLWriter) writeNames(names []*ast.Identifier, depth int) {
+	for i, name := range names {
+		if i > 0 {
+			w.writeTag("symbol", ",", depth)
+		}
+		w.writeTag("identifier", name.Name, depth)
+	}
+}
+
+func (w *XMLWriter) writeType(t *ast.Type, depth int) {
+	if t.IsBuiltin() {
+		w.writeTag("keyword", t.Name, depth)
+	} else {
+		w.writeTag("identifier", t.Name, depth)
+	}
+}
+
+func (w *XMLWriter) writeTag(tag string, content string, stackDepth ...int) {
+	blank := strings.Repeat("  ", stackDepth[0])
+	_, _ = fmt.Fprintf(w.Out, "%s<%s> %s </%s>\n", blank, tag, escapeXml(content), tag)
+}
+
+func (w *XMLWriter) writePureTag(tag string, isStartTag bool, stackDepth ...int) {
+	blank := strings.Repeat("  ", stackDepth[0])
+	var line string
+	if isStartTag {
+		line = fmt.Sprintf("<%s>\n", tag)
+	} else {
+		line = fmt.Sprintf("</%s>\n", tag)
+	}
+	_, _ = io.WriteString(w.Out, blank+line)
+}
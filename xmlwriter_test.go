@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"compiler/parser"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// every testdata/*/X.jack parses to exactly testdata/*/X.xml, the reference
+// parse tree of the course
+func TestXMLGolden(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "*", "*.jack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 {
+		t.Fatal("no sources in testdata")
+	}
+	for _, source := range sources {
+		golden := strings.TrimSuffix(source, ".jack") + ".xml"
+		engine := parser.New(buildTokenizer(source))
+		class := engine.CompileClass()
+		if len(engine.Errors) > 0 {
+			t.Errorf("%s: %v", source, engine.Errors)
+			continue
+		}
+		var got bytes.Buffer
+		buildXMLWriter(&got).writeClass(class, 0)
+
+		if *update {
+			if err := os.WriteFile(golden, got.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want) {
+			gotLines, wantLines := strings.Split(got.String(), "\n"), strings.Split(string(want), "\n")
+			for i := 0; i < len(gotLines) && i < len(wantLines); i++ {
+				if gotLines[i] != wantLines[i] {
+					t.Errorf("%s:%d: got %q, want %q", golden, i+1, gotLines[i], wantLines[i])
+					break
+				}
+			}
+			if len(gotLines) != len(wantLines) {
+				t.Errorf("%s: got %d lines, want %d", golden, len(gotLines), len(wantLines))
+			}
+		}
+	}
+}
+
+func TestXMLEscapesContent(t *testing.T) {
+	var got bytes.Buffer
+	src := `class Main { function void f() { do g("a<b & c>", x < y); return; } }`
+	buildXMLWriter(&got).writeClass(parse(t, src), 0)
+	for _, want := range []string{
+		"<stringConstant> a&lt;b &amp; c&gt; </stringConstant>\n",
+		"<symbol> &lt; </symbol>\n",
+	} {
+		if !strings.Contains(got.String(), want) {
+			t.Errorf("output has no %q:\n%s", want, got.String())
+		}
+	}
+}